@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os" // For os.Exit
 
@@ -11,8 +13,10 @@ import (
 	"github.com/fatih/color"
 	"github.com/joho/godotenv"                                // Added godotenv
 	"github.com/strivescan/strivescan-sftp/internal/database" // Added database import
+	"github.com/strivescan/strivescan-sftp/internal/laravelcrypt"
 	"github.com/strivescan/strivescan-sftp/internal/models"
 	proc "github.com/strivescan/strivescan-sftp/internal/processor"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
 )
 
 func main() {
@@ -23,11 +27,23 @@ func main() {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 
+	// encrypt prints only the payload, so it runs before the banner
+	if len(os.Args) > 1 && os.Args[1] == "encrypt" {
+		runEncrypt(os.Args[2:])
+		return
+	}
+
 	// --- Banner ---
 	myFigure := figure.NewFigure("StriveScan SFTP", "", true)
 	cyan := color.New(color.FgCyan).SprintFunc()
 	fmt.Println(cyan(myFigure.String()))
 
+	// --- Subcommands ---
+	if len(os.Args) > 1 && os.Args[1] == "resend" {
+		runResend(os.Args[2:])
+		return
+	}
+
 	// --- Flags ---
 	dataType := flag.String("type", "scans", "Type of data to process (scans or connections)")
 	scanType := flag.String("scan-type", "student", "Type of scan to process (student, professional, cis, or all)")
@@ -35,9 +51,27 @@ func main() {
 	teamID := flag.Int("team", 0, "Specific team ID to process (optional)") // Use 0 as a sentinel for 'not set'
 	force := flag.Bool("force", false, "Force reprocessing even if data seems up-to-date")
 	debug := flag.Bool("debug", false, "Enable debug mode for query logging")
+	profile := flag.String("profile", proc.ProfileStandard, "Export profile to use (standard, full or slate)")
+	slateMapping := flag.String("slate-mapping", "", "Write the Slate source format mapping document to this path and exit")
+	outputDir := flag.String("output-dir", defaultOutputDir(), "Root directory for export files, runs and archives (overrides OUTPUT_DIR)")
+	retentionDays := flag.Int("retention-days", 30, "Delete archived sent files older than this many days (0 keeps them forever)")
 
 	flag.Parse() // Parse the flags
 
+	if _, err := proc.GetExportProfile(*profile); err != nil {
+		color.Red("Invalid profile specified: %v", err)
+		os.Exit(1)
+	}
+
+	if *slateMapping != "" {
+		if err := proc.WriteSlateMapping(*slateMapping); err != nil {
+			color.Red("Error writing Slate mapping: %v", err)
+			os.Exit(1)
+		}
+		color.Green("Slate mapping written to %s", *slateMapping)
+		return
+	}
+
 	// --- Database Connection ---
 	fmt.Println("\nConnecting to database...")
 	db, err := database.ConnectDB()
@@ -59,6 +93,7 @@ func main() {
 	} else {
 		fmt.Println("Team ID: (Not specified)")
 	}
+	fmt.Printf("Profile: %s\n", *profile)
 	if *force {
 		fmt.Println("Force: true")
 	}
@@ -71,13 +106,26 @@ func main() {
 	fmt.Printf("\nProcessing data type: %s\n", *dataType)
 
 	var student_data interface{}
+	run := proc.NewRun(*outputDir)
+	fmt.Printf("Run ID: %s (writing to %s)\n", run.ID, run.Dir())
 
 	if *dataType == "scans" {
+		teamSettings, invalidSettings, err := proc.LoadTeamSettings(db, *teamID)
+		if err != nil {
+			color.Red("Error loading team settings: %v", err)
+			os.Exit(1)
+		}
+
 		config := proc.Config{
-			Days:   *days,
-			TeamID: *teamID,
-			Force:  *force,
-			Type:   *dataType,
+			Days:    *days,
+			TeamID:  *teamID,
+			Force:   *force,
+			Type:    *dataType,
+			Profile: *profile,
+
+			Run:             run,
+			TeamSettings:    teamSettings,
+			InvalidSettings: invalidSettings,
 		}
 
 		// Process scans based on scan type
@@ -128,6 +176,10 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := run.MarkComplete(); err != nil {
+		color.Red("Error marking run %s complete: %v", run.ID, err)
+		os.Exit(1)
+	}
 	color.Green("\nCSV Creation Complete.")
 
 	// Process files with SFTP processor
@@ -145,13 +197,99 @@ func main() {
 		fairIDs = append(fairIDs, scan.FairID)
 	}
 
-	sftpProcessor := proc.NewSFTPProcessor(db, *teamID, studentIDs, fairIDs)
+	sftpProcessor := proc.NewSFTPProcessor(db, *teamID, studentIDs, fairIDs, run)
 	fmt.Println("Processing SFTP files...")
-	err = sftpProcessor.Process()
+	processErr := sftpProcessor.Process()
+	if processErr != nil {
+		color.Red("Error processing SFTP files: %v", processErr)
+	}
+
+	// Old archives are pruned even when an upload failed, so a team that keeps
+	// failing doesn't stop retention for everyone
+	pruned, pruneErr := proc.PruneArchives(*outputDir, *retentionDays)
+	for _, dir := range pruned {
+		fmt.Printf("Pruned archive %s\n", dir)
+	}
+	if pruneErr != nil {
+		color.Red("Error pruning archives: %v", pruneErr)
+	}
+
+	if processErr != nil || pruneErr != nil {
+		os.Exit(1)
+	}
+}
+
+// runResend uploads files from earlier runs: those a failed delivery left in
+// output/runs/*/<team>/ or, from before runs had their own directories,
+// output/<team>/. With -date it resends those archived as sent on that day.
+func runResend(args []string) {
+	fs := flag.NewFlagSet("resend", flag.ExitOnError)
+	teamID := fs.Int("team", 0, "Team ID to resend files for (required)")
+	outputDir := fs.String("output-dir", defaultOutputDir(), "Root directory for export files, runs and archives (overrides OUTPUT_DIR)")
+	date := fs.String("date", "", "Resend the files archived as sent on this day (YYYY-MM-DD) instead of pending ones")
+	fs.Parse(args)
+
+	if *teamID == 0 {
+		color.Red("resend requires -team")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	fmt.Println("\nConnecting to database...")
+	db, err := database.ConnectDB()
+	if err != nil {
+		color.Red("Database connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if *date != "" {
+		fmt.Printf("Resending files archived on %s for team %d...\n", *date, *teamID)
+	} else {
+		fmt.Printf("Resending pending files for team %d...\n", *teamID)
+	}
+
+	sftpProcessor := proc.NewResendProcessor(db, *teamID, *outputDir, *date)
+	if err := sftpProcessor.Process(); err != nil {
+		color.Red("Error resending SFTP files: %v", err)
+		os.Exit(1)
+	}
+}
+
+// runEncrypt reads a credential from stdin and prints it encrypted with
+// LARAVEL_ENCRYPTION_KEY, ready to store in sftp_credentials. The output
+// decrypts with Laravel's Crypt::decryptString. Encrypting a JSON object of
+// team secrets the same way produces a SECRETS_FILE for the file provider.
+func runEncrypt(args []string) {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	keepNewline := fs.Bool("keep-newline", false, "Keep a trailing newline in the input (trimmed by default)")
+	fs.Parse(args)
+
+	// The value stays in a byte slice so it can be wiped; see
+	// secrets.Credentials for the copies that can't be
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		color.Red("Error reading input: %v", err)
+		os.Exit(1)
+	}
+	defer redact.Secret(input).Wipe()
+	value := input
+	if !*keepNewline {
+		value = bytes.TrimSuffix(bytes.TrimSuffix(value, []byte("\n")), []byte("\r"))
+	}
+
+	crypter, err := laravelcrypt.FromEnv()
+	if err != nil {
+		color.Red("Error loading encryption key: %v", err)
+		os.Exit(1)
+	}
+
+	encrypted, err := crypter.Encrypt(value)
 	if err != nil {
-		color.Red("Error processing SFTP files: %v", err)
+		color.Red("Error encrypting value: %v", err)
 		os.Exit(1)
 	}
+	fmt.Println(encrypted)
 }
 
 // processScans handles the common processing logic for both student and professional scans
@@ -163,8 +301,18 @@ func processScans(processor proc.DataProcessor, config proc.Config, db *sql.DB)
 		os.Exit(1)
 	}
 
-	// Transform data into grouped map
-	groupedCsvData, err := processor.TransformData(rawData)
+	// Transform data into grouped map, using the export profile's fixed layout if one was chosen
+	profile, err := proc.GetExportProfile(config.Profile)
+	if err != nil {
+		color.Red("Error loading export profile: %v", err)
+		os.Exit(1)
+	}
+	var groupedCsvData map[int64][][]string
+	if profile != nil {
+		groupedCsvData, err = profile.TransformData(rawData)
+	} else {
+		groupedCsvData, err = processor.TransformData(rawData)
+	}
 	if err != nil {
 		color.Red("Error transforming data: %v", err)
 		os.Exit(1)
@@ -188,3 +336,11 @@ func processScans(processor proc.DataProcessor, config proc.Config, db *sql.DB)
 
 	return rawData
 }
+
+// defaultOutputDir returns OUTPUT_DIR if set, otherwise the default output root.
+func defaultOutputDir() string {
+	if dir := os.Getenv("OUTPUT_DIR"); dir != "" {
+		return dir
+	}
+	return proc.DefaultOutputRoot
+}
@@ -3,19 +3,22 @@ module github.com/strivescan/strivescan-sftp
 go 1.24.2
 
 require (
+	github.com/ProtonMail/go-crypto v1.3.0
 	github.com/common-nighthawk/go-figure v0.0.0-20210622060536-734e95fb86be
 	github.com/cristalhq/base64 v0.1.2
 	github.com/fatih/color v1.18.0
 	github.com/go-sql-driver/mysql v1.9.2
 	github.com/joho/godotenv v1.5.1
+	github.com/pkg/sftp v1.13.9
 	golang.org/x/crypto v0.37.0
+	golang.org/x/text v0.24.0
 )
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/cloudflare/circl v1.6.1 // indirect
 	github.com/kr/fs v0.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/pkg/sftp v1.13.9 // indirect
 	golang.org/x/sys v0.32.0 // indirect
 )
@@ -0,0 +1,334 @@
+// Package laravelcrypt encrypts and decrypts values in the format of Laravel's
+// Crypt facade (Crypt::encryptString / Crypt::decryptString), so credentials
+// can be shared with the PHP application.
+//
+// A payload is the base64 encoding of a JSON object with iv, value, mac and
+// tag fields. AES-CBC payloads are authenticated by a hex HMAC-SHA256 over the
+// base64 iv and value in mac; AES-GCM payloads carry the GCM tag in tag and
+// leave mac empty.
+package laravelcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cristalhq/base64"
+)
+
+// Errors returned when a payload can't be decrypted
+var (
+	ErrInvalidMAC     = errors.New("the MAC is invalid")
+	ErrInvalidKey     = errors.New("the encryption key is invalid")
+	ErrInvalidPayload = errors.New("the encrypted payload is invalid")
+)
+
+// payload is the JSON object inside a Laravel encrypted value.
+type payload struct {
+	IV    string `json:"iv"`
+	Value string `json:"value"`
+	MAC   string `json:"mac"`
+	Tag   string `json:"tag"`
+}
+
+// Encrypter holds the current key and any previous keys still accepted for
+// decryption, mirroring APP_KEY and APP_PREVIOUS_KEYS.
+type Encrypter struct {
+	keys [][]byte
+}
+
+// New returns an Encrypter for key, which may carry Laravel's "base64:"
+// prefix. Previous keys are tried in order when decrypting.
+func New(key string, previous ...string) (*Encrypter, error) {
+	e := &Encrypter{}
+	for i, k := range append([]string{key}, previous...) {
+		parsed, err := parseKey(k)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("previous key #%d: %w", i, err)
+		}
+		e.keys = append(e.keys, parsed)
+	}
+	return e, nil
+}
+
+// FromEnv builds an Encrypter from LARAVEL_ENCRYPTION_KEY and the
+// comma-separated LARAVEL_PREVIOUS_KEYS (or APP_PREVIOUS_KEYS).
+func FromEnv() (*Encrypter, error) {
+	appKey := os.Getenv("LARAVEL_ENCRYPTION_KEY")
+	if appKey == "" {
+		return nil, errors.New("LARAVEL_ENCRYPTION_KEY environment variable not set")
+	}
+
+	previous := os.Getenv("LARAVEL_PREVIOUS_KEYS")
+	if previous == "" {
+		previous = os.Getenv("APP_PREVIOUS_KEYS")
+	}
+
+	keys := []string{}
+	for _, key := range strings.Split(previous, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return New(appKey, keys...)
+}
+
+// parseKey decodes a base64 key and checks it suits AES-128 or AES-256.
+func parseKey(key string) ([]byte, error) {
+	key = strings.TrimPrefix(key, "base64:")
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding key: %v", ErrInvalidKey, err)
+	}
+	if len(decoded) != 16 && len(decoded) != 32 {
+		return nil, fmt.Errorf("%w: key is %d bytes, expected 16 or 32", ErrInvalidKey, len(decoded))
+	}
+	return decoded, nil
+}
+
+// EncryptString encrypts plaintext with the current key using AES-CBC, as
+// Laravel's default cipher does, and returns the payload.
+func (e *Encrypter) EncryptString(plaintext string) (string, error) {
+	return e.Encrypt([]byte(plaintext))
+}
+
+// Encrypt is EncryptString for a byte slice.
+func (e *Encrypter) Encrypt(plaintext []byte) (string, error) {
+	key := e.keys[0]
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	padded := addPadding(plaintext)
+	defer wipe(padded)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	p := payload{
+		IV:    base64.StdEncoding.EncodeToString(iv),
+		Value: base64.StdEncoding.EncodeToString(ciphertext),
+	}
+	p.MAC = hex.EncodeToString(computeMAC(key, p.IV, p.Value))
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptString decrypts a payload, trying the current key and then each
+// previous key.
+func (e *Encrypter) DecryptString(encrypted string) (string, error) {
+	plaintext, _, err := e.DecryptWithKeyIndex(encrypted)
+	return string(plaintext), err
+}
+
+// DecryptWithKeyIndex decrypts a payload into a byte slice the caller can
+// wipe, and also returns the index of the key that worked: 0 for the current
+// key, n for the nth previous key. A non-zero index means the value still
+// needs re-encrypting with the current key. Only a MAC mismatch moves on to
+// the next key.
+func (e *Encrypter) DecryptWithKeyIndex(encrypted string) ([]byte, int, error) {
+	p, err := parsePayload(encrypted)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i, key := range e.keys {
+		plaintext, err := decryptPayload(p, key)
+		if errors.Is(err, ErrInvalidMAC) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return plaintext, i, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w for all %d keys", ErrInvalidMAC, len(e.keys))
+}
+
+// parsePayload accepts the JSON object itself or its base64 encoding, with
+// missing padding repaired.
+func parsePayload(encrypted string) (payload, error) {
+	var p payload
+	if err := json.Unmarshal([]byte(encrypted), &p); err != nil {
+		// Remove any whitespace and newlines, and add padding if needed
+		encrypted = strings.TrimSpace(encrypted)
+		if len(encrypted)%4 != 0 {
+			encrypted += strings.Repeat("=", 4-len(encrypted)%4)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(encrypted)
+		if err != nil {
+			return p, fmt.Errorf("%w: failed to decode base64: %v", ErrInvalidPayload, err)
+		}
+		if err := json.Unmarshal(decoded, &p); err != nil {
+			return p, fmt.Errorf("%w: failed to unmarshal JSON: %v", ErrInvalidPayload, err)
+		}
+	}
+
+	if p.IV == "" || p.Value == "" {
+		return p, fmt.Errorf("%w: missing required fields in JSON", ErrInvalidPayload)
+	}
+	return p, nil
+}
+
+func decryptPayload(p payload, key []byte) ([]byte, error) {
+	if p.Tag != "" {
+		return decryptGCM(p, key)
+	}
+
+	if err := verifyMAC(key, p.IV, p.Value, p.MAC); err != nil {
+		return nil, err
+	}
+
+	iv, err := base64.StdEncoding.DecodeString(p.IV)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode IV: %v", ErrInvalidPayload, err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: IV is %d bytes, expected %d", ErrInvalidPayload, len(iv), aes.BlockSize)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(p.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode ciphertext: %v", ErrInvalidPayload, err)
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: ciphertext is not a whole number of blocks", ErrInvalidPayload)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	unpadded, err := removePadding(plaintext)
+	if err != nil {
+		wipe(plaintext)
+		return nil, err
+	}
+	return unpadded, nil
+}
+
+// decryptGCM decrypts an AES-GCM payload, whose tag authenticates the
+// ciphertext in place of a MAC. A tag mismatch is reported as ErrInvalidMAC so
+// the next key is tried.
+func decryptGCM(p payload, key []byte) ([]byte, error) {
+	iv, err := base64.StdEncoding.DecodeString(p.IV)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode IV: %v", ErrInvalidPayload, err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(p.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode ciphertext: %v", ErrInvalidPayload, err)
+	}
+	tag, err := base64.StdEncoding.DecodeString(p.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode tag: %v", ErrInvalidPayload, err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	if len(iv) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: IV is %d bytes, expected %d", ErrInvalidPayload, len(iv), gcm.NonceSize())
+	}
+	if len(tag) != gcm.Overhead() {
+		return nil, fmt.Errorf("%w: tag is %d bytes, expected %d", ErrInvalidPayload, len(tag), gcm.Overhead())
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), nil)
+	if err != nil {
+		return nil, ErrInvalidMAC
+	}
+	return plaintext, nil
+}
+
+func computeMAC(key []byte, iv string, value string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(iv + value))
+	return h.Sum(nil)
+}
+
+// verifyMAC checks the payload's hex HMAC-SHA256 over iv+value in constant
+// time.
+func verifyMAC(key []byte, iv string, value string, mac string) error {
+	if mac == "" {
+		return fmt.Errorf("%w: payload has no MAC", ErrInvalidMAC)
+	}
+	expected, err := hex.DecodeString(mac)
+	if err != nil {
+		return fmt.Errorf("%w: MAC is not hex encoded", ErrInvalidMAC)
+	}
+	if !hmac.Equal(computeMAC(key, iv, value), expected) {
+		return ErrInvalidMAC
+	}
+	return nil
+}
+
+// addPadding applies PKCS#7 padding
+func addPadding(data []byte) []byte {
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := make([]byte, len(data), len(data)+padding)
+	copy(padded, data)
+	for i := 0; i < padding; i++ {
+		padded = append(padded, byte(padding))
+	}
+	return padded
+}
+
+// wipe overwrites b with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// removePadding removes PKCS#7 padding
+func removePadding(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, errors.New("invalid padding")
+	}
+
+	for i := len(data) - padding; i < len(data); i++ {
+		if int(data[i]) != padding {
+			return nil, errors.New("invalid padding")
+		}
+	}
+
+	return data[:len(data)-padding], nil
+}
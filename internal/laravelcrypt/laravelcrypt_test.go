@@ -0,0 +1,155 @@
+package laravelcrypt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// Known-answer payloads in the exact format of Laravel's
+// Encrypter::encryptString: base64 of {"iv","value","mac","tag"} with
+// unescaped slashes, the value produced by OpenSSL's EVP API as PHP's
+// openssl_encrypt does, with fixed IVs in place of random ones.
+const (
+	key256 = "base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	key128 = "base64:ZGVmZ2hpamtsbW5vcHFycw=="
+	keyOld = "base64:yMnKy8zNzs/Q0dLT1NXW19jZ2tvc3d7f4OHi4+Tl5uc="
+
+	// AES-256-CBC of "s3cr3t-Pa$$word" under key256
+	payloadCBC256 = "eyJpdiI6IkVCRVNFeFFWRmhjWUdSb2JIQjBlSHc9PSIsInZhbHVlIjoicWJTekhMWEpBVzlkRXF0WjkrK2VRdz09IiwibWFjIjoiMjY0OTY4ZWI4OTc3MjExOGU4NGNlYTkwNjBlMzA1NjZhNWRhZTFhNTcyZjg0MDZjZjI1Y2RkMTUxZjg1ZWQ2OSIsInRhZyI6IiJ9"
+	// AES-128-CBC of "correct horse battery staple" under key128
+	payloadCBC128 = "eyJpdiI6Ik1ERXlNelExTmpjNE9UbzdQRDArUHc9PSIsInZhbHVlIjoiRU1yVnFTbFVka3dIL3kxRklOM2ZvZE5xajNYUHZLYjExVGxRTHNiZmo2bz0iLCJtYWMiOiIwMzVjMmM3YjdkNzYyZDE4NDA2MGFjMTQ2NWI2NTg2ZjE1N2IwNzM4ZTViY2I2ZjljM2NhYzQ5Y2Y1ZjI4MDBjIiwidGFnIjoiIn0="
+	// AES-256-GCM of "zip-password/with+slashes" under key256; mac is empty
+	payloadGCM256 = "eyJpdiI6IlFFRkNRMFJGUmtkSVNVcEwiLCJ2YWx1ZSI6Im1ORGVEbFpkOUhDNnEyVlN0Qk42THhIdElURFdSbWRHQkE9PSIsIm1hYyI6IiIsInRhZyI6Ijh6Tk9YSkVPSStyVTJBdXlyZ2JhK3c9PSJ9"
+	// AES-256-CBC of "rotated secret" under keyOld
+	payloadOldKey = "eyJpdiI6IlVGRlNVMVJWVmxkWVdWcGJYRjFlWHc9PSIsInZhbHVlIjoibWlTT1dXVkFaY2pKVnltVDlMbmt3Zz09IiwibWFjIjoiOTU4NjMyNWJhZGViZDUzYzY2ZDAzYmQyYzFjMThjNTQyNDEyNTFiYmU2MWJlNzU2MzdmNWUzMmNmZTNiZDIxNiIsInRhZyI6IiJ9"
+)
+
+func mustNew(t *testing.T, key string, previous ...string) *Encrypter {
+	t.Helper()
+	e, err := New(key, previous...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return e
+}
+
+// tamper decodes a payload, lets edit change it and encodes it again.
+func tamper(t *testing.T, encrypted string, edit func(p *payload)) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	edit(&p)
+	data, err = json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestDecryptKnownAnswers(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		payload string
+		want    string
+	}{
+		{"AES-256-CBC", key256, payloadCBC256, "s3cr3t-Pa$$word"},
+		{"AES-128-CBC", key128, payloadCBC128, "correct horse battery staple"},
+		{"AES-256-GCM", key256, payloadGCM256, "zip-password/with+slashes"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mustNew(t, tc.key).DecryptString(tc.payload)
+			if err != nil {
+				t.Fatalf("DecryptString: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("decrypted %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecryptTamperedPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"CBC mac", tamper(t, payloadCBC256, func(p *payload) {
+			p.MAC = "0" + p.MAC[1:]
+		})},
+		{"CBC value", tamper(t, payloadCBC256, func(p *payload) {
+			p.Value = "A" + p.Value[1:]
+		})},
+		{"CBC mac removed", tamper(t, payloadCBC256, func(p *payload) {
+			p.MAC = ""
+		})},
+		{"GCM tag", tamper(t, payloadGCM256, func(p *payload) {
+			tag, _ := base64.StdEncoding.DecodeString(p.Tag)
+			tag[0] ^= 0x01
+			p.Tag = base64.StdEncoding.EncodeToString(tag)
+		})},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := mustNew(t, key256).DecryptWithKeyIndex(tc.payload)
+			if !errors.Is(err, ErrInvalidMAC) {
+				t.Errorf("got %v, want ErrInvalidMAC", err)
+			}
+		})
+	}
+}
+
+func TestDecryptWithPreviousKey(t *testing.T) {
+	e := mustNew(t, key256, key128, keyOld)
+
+	plaintext, index, err := e.DecryptWithKeyIndex(payloadOldKey)
+	if err != nil {
+		t.Fatalf("DecryptWithKeyIndex: %v", err)
+	}
+	if string(plaintext) != "rotated secret" {
+		t.Errorf("decrypted %q, want %q", plaintext, "rotated secret")
+	}
+	if index != 2 {
+		t.Errorf("key index = %d, want 2", index)
+	}
+
+	_, index, err = mustNew(t, key256, keyOld).DecryptWithKeyIndex(payloadOldKey)
+	if err != nil || index != 1 {
+		t.Errorf("with one previous key: index %d, err %v; want 1, nil", index, err)
+	}
+
+	_, index, err = e.DecryptWithKeyIndex(payloadCBC256)
+	if err != nil || index != 0 {
+		t.Errorf("current key payload: index %d, err %v; want 0, nil", index, err)
+	}
+
+	if _, _, err := mustNew(t, key256).DecryptWithKeyIndex(payloadOldKey); !errors.Is(err, ErrInvalidMAC) {
+		t.Errorf("without the previous key: got %v, want ErrInvalidMAC", err)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	e := mustNew(t, key256)
+	encrypted, err := e.EncryptString("round trip")
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+	got, err := e.DecryptString(encrypted)
+	if err != nil {
+		t.Fatalf("DecryptString: %v", err)
+	}
+	if got != "round trip" {
+		t.Errorf("decrypted %q, want %q", got, "round trip")
+	}
+}
@@ -0,0 +1,41 @@
+// Package logging wraps the console output used across the tool so that every
+// message passes through redaction first: Secret values print as [REDACTED]
+// and sensitive struct fields are never written.
+package logging
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
+)
+
+// Printf writes a plain message to stdout.
+func Printf(format string, args ...interface{}) {
+	fmt.Printf(format, redact.Args(args...)...)
+}
+
+// Println writes a plain line to stdout.
+func Println(args ...interface{}) {
+	fmt.Println(redact.Args(args...)...)
+}
+
+// Red writes an error message.
+func Red(format string, args ...interface{}) {
+	color.Red(format, redact.Args(args...)...)
+}
+
+// Yellow writes a warning.
+func Yellow(format string, args ...interface{}) {
+	color.Yellow(format, redact.Args(args...)...)
+}
+
+// Green writes a success message.
+func Green(format string, args ...interface{}) {
+	color.Green(format, redact.Args(args...)...)
+}
+
+// Magenta writes a stage heading.
+func Magenta(format string, args ...interface{}) {
+	color.Magenta(format, redact.Args(args...)...)
+}
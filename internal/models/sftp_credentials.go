@@ -4,18 +4,25 @@ import (
 	"database/sql"
 )
 
+// SFTPCredentials is a row of sftp_credentials. Fields tagged sensitive hold
+// encrypted secrets and are redacted by the logging package.
 type SFTPCredentials struct {
 	ID                int64          `db:"id"`
 	TeamID            int64          `db:"team_id"`
 	Host              string         `db:"host"`
 	Port              string         `db:"port"`
 	Username          string         `db:"username"`
-	Password          sql.NullString `db:"password"`
-	SSHKey            sql.NullString `db:"ssh_key"`
+	Password          sql.NullString `db:"password" sensitive:"true"`
+	SSHKey            sql.NullString `db:"ssh_key" sensitive:"true"`
 	SSHKeyFilename    sql.NullString `db:"ssh_key_filename"`
-	Passphrase        sql.NullString `db:"passphrase"`
+	Passphrase        sql.NullString `db:"passphrase" sensitive:"true"`
 	UploadDirectory   sql.NullString `db:"upload_directory"`
 	NotificationEmail sql.NullString `db:"notification_email"`
+	PGPPublicKey      sql.NullString `db:"pgp_public_key"`                   // Partner's OpenPGP public key, armored
+	ZipPassword       sql.NullString `db:"zip_password" sensitive:"true"`    // Encrypted password for AES zip bundles
+	SOCKS5Username    sql.NullString `db:"socks5_username" sensitive:"true"` // Encrypted SOCKS5 proxy username
+	SOCKS5Password    sql.NullString `db:"socks5_password" sensitive:"true"` // Encrypted SOCKS5 proxy password
+	Settings          sql.NullString `db:"settings"`                         // JSON encoded SFTPSettings
 	CreatedAt         sql.NullTime   `db:"created_at"`
 	UpdatedAt         sql.NullTime   `db:"updated_at"`
 }
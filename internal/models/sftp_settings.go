@@ -0,0 +1,94 @@
+package models
+
+// SFTPSettings holds the per-team delivery options stored as JSON in the
+// settings column of sftp_credentials. Zero values keep the default behavior.
+type SFTPSettings struct {
+	Format string     `json:"format"` // csv (default), jsonl, json or xlsx
+	CSV    CSVDialect `json:"csv"`
+
+	// FilenameTemplate names export files, e.g.
+	// "{team}_{scan_type}_{fair}_{date:2006-01-02}_{seq}.{ext}". Empty uses
+	// the default StriveScan-Scans-Export name. Zip bundles use it too, with
+	// {scan_type} BUNDLE and {fair} all.
+	FilenameTemplate string `json:"filename_template"`
+
+	// PGPEncrypt encrypts files to the team's pgp_public_key before upload,
+	// and PGPSign also signs them with our key.
+	PGPEncrypt bool `json:"pgp_encrypt"`
+	PGPSign    bool `json:"pgp_sign"`
+
+	// Compression gzips each file ("gzip") or bundles all of a run's files
+	// with a manifest into one zip ("zip"). ZipEncrypt protects the zip with
+	// WinZip AES-256 using the team's zip_password.
+	Compression string `json:"compression"`
+	ZipEncrypt  bool   `json:"zip_encrypt"`
+
+	// ChecksumSidecars uploads a sha256sum-style .sha256 file beside each
+	// export. A JSON manifest and a .done file are always uploaded.
+	ChecksumSidecars bool `json:"checksum_sidecars"`
+
+	// Verify selects the post-upload check: "size" (default) compares the
+	// remote size, "hash" also reads the file back and compares SHA-256.
+	// UploadRetries is how often a failed or mismatched upload is retried;
+	// unset uses the default and zero disables retries.
+	Verify        string `json:"verify"`
+	UploadRetries *int   `json:"upload_retries"`
+
+	// SSHAgent also offers the keys held by the ssh-agent at SSH_AUTH_SOCK.
+	// SSHCertificate names an OpenSSH user certificate in SSH_KEY_DIR, signed
+	// by our CA, presented with whichever of the team's keys it certifies.
+	SSHAgent       bool   `json:"ssh_agent"`
+	SSHCertificate string `json:"ssh_certificate"`
+
+	// AuthOrder lists the SSH auth methods to offer, in order: "publickey",
+	// "password" and "keyboard-interactive". Servers that require several
+	// (e.g. key then password) are satisfied from this list. Empty offers
+	// every method the team has credentials for, in that order.
+	// Keyboard-interactive answers only from stored credentials: password
+	// prompts, or a lone hidden prompt, get the password, and username
+	// prompts the username. Any other prompt, such as a one-time code or a
+	// Duo push choice, fails the attempt, so servers requiring one cannot be
+	// reached unattended.
+	AuthOrder []string `json:"auth_order"`
+
+	// ProxyJump reaches the server through SSH hops, like OpenSSH's
+	// ProxyJump: "[user@]host[:port]" entries separated by commas, each
+	// authenticated with the team's credentials. SOCKS5Proxy dials the first
+	// hop, or the server itself, through a SOCKS5 proxy given as
+	// "socks5://host:port"; empty uses SFTP_SOCKS5_PROXY. Proxy credentials
+	// are secrets, kept with the team's other secrets as socks5_username and
+	// socks5_password. Either requires SSH_KNOWN_HOSTS, which must list the
+	// host key of every hop and of the server.
+	ProxyJump   string `json:"proxy_jump"`
+	SOCKS5Proxy string `json:"socks5_proxy"`
+
+	// ConnectTimeout bounds connecting and the SSH handshake at each hop, and
+	// IOTimeout any single read or write once connected, both in seconds.
+	// KeepaliveInterval sends keepalive@openssh.com every n seconds so idle
+	// sessions survive and dead ones are noticed; negative disables it, and
+	// with it the read timeout, which an idle session would otherwise hit.
+	// Zero values use the defaults of 30, 300 and 30 seconds.
+	ConnectTimeout    int `json:"connect_timeout"`
+	IOTimeout         int `json:"io_timeout"`
+	KeepaliveInterval int `json:"keepalive_interval"`
+
+	// Ciphers, KeyExchanges, MACs and HostKeyAlgorithms replace the SSH
+	// algorithms offered, in preference order. Empty lists use defaults
+	// without SHA-1 or CBC; legacy servers can be given e.g. "aes128-cbc",
+	// "diffie-hellman-group14-sha1" or "ssh-rsa".
+	Ciphers           []string `json:"ciphers"`
+	KeyExchanges      []string `json:"key_exchanges"`
+	MACs              []string `json:"macs"`
+	HostKeyAlgorithms []string `json:"host_key_algorithms"`
+}
+
+// CSVDialect controls how CSV files are written for a team. The zero value is
+// comma-delimited, minimally quoted, LF-terminated UTF-8 without a BOM.
+type CSVDialect struct {
+	Delimiter     string `json:"delimiter"`     // single character, e.g. "\t" or "|"
+	Quoting       string `json:"quoting"`       // minimal (default) or all
+	BOM           bool   `json:"bom"`           // prefix a UTF-8 byte order mark
+	LineEnding    string `json:"line_ending"`   // lf (default) or crlf
+	Encoding      string `json:"encoding"`      // utf-8 (default) or windows-1252
+	Transliterate bool   `json:"transliterate"` // drop accents the encoding can't represent, e.g. ễ to e
+}
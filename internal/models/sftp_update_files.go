@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SFTPUpdateFile records the outcome of one file within an SFTP delivery
+type SFTPUpdateFile struct {
+	ID           uint       `db:"id"`
+	SFTPUpdateID int64      `db:"sftp_update_id"`
+	Name         string     `db:"name"`
+	Size         int64      `db:"size"`
+	SHA256       string     `db:"sha256"`
+	Status       string     `db:"status"` // success, failure or skipped
+	Error        string     `db:"error"`
+	CreatedAt    *time.Time `db:"created_at"`
+	UpdatedAt    *time.Time `db:"updated_at"`
+}
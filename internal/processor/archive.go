@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveDirName is the directory under the output root holding sent files,
+// laid out as sent/<YYYY-MM-DD>/<team>/.
+const archiveDirName = "sent"
+
+// archiveDateLayout names the dated archive directories.
+const archiveDateLayout = "2006-01-02"
+
+// archiveTeamDir returns the archive directory for a team on a given day.
+func archiveTeamDir(root string, date time.Time, teamID int64) string {
+	return filepath.Join(root, archiveDirName, date.Format(archiveDateLayout), strconv.FormatInt(teamID, 10))
+}
+
+// archiveFiles moves delivered files into today's archive for the team and
+// returns their new paths. A file already archived under the same name is
+// kept, and the new one gets a numbered name instead.
+func archiveFiles(files []string, root string, teamID int64) ([]string, error) {
+	dir := archiveTeamDir(root, time.Now(), teamID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory %s: %w", dir, err)
+	}
+
+	archived := make([]string, 0, len(files))
+	for _, path := range files {
+		dest, err := moveWithoutOverwrite(path, dir)
+		if err != nil {
+			return archived, fmt.Errorf("failed to archive %s: %w", path, err)
+		}
+		archived = append(archived, dest)
+	}
+	return archived, nil
+}
+
+// moveWithoutOverwrite moves path into dir, adding -2, -3 and so on before the
+// extensions until the name is free. Linking, unlike renaming, fails when the
+// destination exists, so a file is never replaced.
+func moveWithoutOverwrite(path string, dir string) (string, error) {
+	name := filepath.Base(path)
+	stem, ext := name, ""
+	if i := strings.Index(name[1:], "."); i >= 0 {
+		stem, ext = name[:i+1], name[i+1:]
+	}
+
+	dest := filepath.Join(dir, name)
+	for n := 2; ; n++ {
+		err := os.Link(path, dest)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		dest = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, n, ext))
+	}
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// PruneArchives removes dated archive directories older than retentionDays
+// and returns the directories removed. A retention of zero or less keeps
+// everything.
+func PruneArchives(root string, retentionDays int) ([]string, error) {
+	if retentionDays <= 0 {
+		return nil, nil
+	}
+
+	archiveRoot := filepath.Join(root, archiveDirName)
+	entries, err := os.ReadDir(archiveRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory %s: %w", archiveRoot, err)
+	}
+
+	now := time.Now()
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -retentionDays)
+	removed := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		date, err := time.ParseInLocation(archiveDateLayout, entry.Name(), time.Local)
+		if err != nil {
+			continue // Not one of ours
+		}
+		if !date.Before(cutoff) {
+			continue
+		}
+		dir := filepath.Join(archiveRoot, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("failed to prune %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+// isPrepared reports whether name already carries ext, possibly followed by
+// the PGP extension, so a step that produced it is not applied twice when
+// pending files are resent.
+func isPrepared(name string, ext string) bool {
+	return strings.HasSuffix(name, ext) || strings.HasSuffix(name, ext+pgpExtension)
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveFilesKeepsEarlierArchives(t *testing.T) {
+	root := t.TempDir()
+	dir := archiveTeamDir(root, time.Now(), 5)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"scans.csv.gz", "scans-2.csv.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("earlier"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending := filepath.Join(root, "runs", "run", "5")
+	if err := os.MkdirAll(pending, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{filepath.Join(pending, "scans.csv.gz"), filepath.Join(pending, "other.csv")}
+	for _, path := range files {
+		if err := os.WriteFile(path, []byte("resent"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archived, err := archiveFiles(files, root, 5)
+	if err != nil {
+		t.Fatalf("archiveFiles: %v", err)
+	}
+	want := []string{filepath.Join(dir, "scans-3.csv.gz"), filepath.Join(dir, "other.csv")}
+	if len(archived) != len(want) || archived[0] != want[0] || archived[1] != want[1] {
+		t.Errorf("archived = %v, want %v", archived, want)
+	}
+
+	for name, content := range map[string]string{"scans.csv.gz": "earlier", "scans-2.csv.gz": "earlier", "scans-3.csv.gz": "resent"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q (%v), want %q", name, data, err, content)
+		}
+	}
+	for _, path := range files {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s is still pending after archiving", path)
+		}
+	}
+}
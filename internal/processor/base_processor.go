@@ -2,13 +2,12 @@ package processor
 
 import (
 	"database/sql"
-	"encoding/csv"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
-	"time"
 
+	"github.com/strivescan/strivescan-sftp/internal/logging"
 	"github.com/strivescan/strivescan-sftp/internal/models"
 )
 
@@ -236,33 +235,45 @@ func (bp *BaseProcessor) GetCSVHeader() []string {
 	}
 }
 
+// nullCell is the cell value for a SQL NULL. JSON output writes it as null;
+// every other format writes it as an empty cell, via cellText.
+const nullCell = "\x00"
+
+// cellText returns the text written for a cell, turning NULL into "".
+func cellText(value string) string {
+	if value == nullCell {
+		return ""
+	}
+	return value
+}
+
 // Helper functions for handling nullable types
 func (bp *BaseProcessor) nullStr(ns sql.NullString) string {
 	if ns.Valid {
 		return ns.String
 	}
-	return ""
+	return nullCell
 }
 
 func (bp *BaseProcessor) nullInt(ni sql.NullInt64) string {
 	if ni.Valid {
 		return strconv.FormatInt(ni.Int64, 10)
 	}
-	return ""
+	return nullCell
 }
 
 func (bp *BaseProcessor) nullBool(nb sql.NullBool) string {
 	if nb.Valid {
 		return strconv.FormatBool(nb.Bool)
 	}
-	return ""
+	return nullCell
 }
 
 func (bp *BaseProcessor) nullTime(nt sql.NullTime, format string) string {
 	if nt.Valid {
 		return nt.Time.Format(format)
 	}
-	return ""
+	return nullCell
 }
 
 // TransformScanToRow converts a scan data record to a CSV row
@@ -331,45 +342,112 @@ func (bp *BaseProcessor) TransformScanToRow(scan models.StudentScanData) []strin
 	}
 }
 
-// WriteCSVFile writes the CSV data to a file
-func (bp *BaseProcessor) WriteCSVFile(teamID int64, teamData [][]string, baseOutputDir string, timestamp string) (string, error) {
-	if len(teamData) <= 1 { // Skip teams with only a header row
-		return "", fmt.Errorf("no data rows for team %d", teamID)
+// WriteCSVFile writes the CSV data to a file using the team's CSV dialect
+func (bp *BaseProcessor) WriteCSVFile(teamID int64, teamData [][]string, fp string, dialect models.CSVDialect) (string, error) {
+	// Encode all data for this team before touching the file
+	data, err := encodeTeamCSV(teamID, teamData, dialect)
+	if err != nil {
+		return "", err
 	}
+	return writeCSVData(teamID, data, fp)
+}
 
-	// Create team-specific directory path
-	teamDir := filepath.Join(baseOutputDir, strconv.FormatInt(teamID, 10))
-
-	// Format timestamp in Ymd-hisa format
-	formattedTimestamp := time.Now().Format("20060102-030405pm")
-	filename := fmt.Sprintf("StriveScan-Scans-Export-%s_%s.csv", bp.getScanTypeName(), formattedTimestamp)
-
-	fp := filepath.Join(teamDir, filename)
+// encodeTeamCSV renders a team's header and rows in its CSV dialect.
+func encodeTeamCSV(teamID int64, teamData [][]string, dialect models.CSVDialect) ([]byte, error) {
+	if len(teamData) <= 1 { // Skip teams with only a header row
+		return nil, fmt.Errorf("no data rows for team %d", teamID)
+	}
 
-	// Create the team-specific output directory if it doesn't exist
-	if err := os.MkdirAll(teamDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create output directory '%s' for team %d: %w", teamDir, teamID, err)
+	data, err := encodeCSV(teamData, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode CSV data for team %d: %w", teamID, err)
 	}
+	return data, nil
+}
 
-	// Create and open the file
-	file, err := os.Create(fp)
+// writeCSVData writes encoded CSV data to fp.
+func writeCSVData(teamID int64, data []byte, fp string) (string, error) {
+	file, err := createExportFile(fp)
 	if err != nil {
 		return "", fmt.Errorf("failed to create CSV file '%s' for team %d: %w", fp, teamID, err)
 	}
 	defer file.Close()
 
-	// Create CSV writer
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write all data for this team
-	if err := writer.WriteAll(teamData); err != nil {
+	if _, err := file.Write(data); err != nil {
 		return "", fmt.Errorf("failed to write CSV data for team %d to '%s': %w", teamID, fp, err)
 	}
-
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to close CSV file '%s' for team %d: %w", fp, teamID, err)
+	}
 	return fp, nil
 }
 
+// WriteTeamFiles writes each team's data in the output format and under the
+// file name template configured for the team. All names are reserved up front,
+// so a collision aborts the write before any file is created. All CSV data is
+// encoded up front too; a team with a value its encoding can't represent is
+// reported and skipped, and the other teams are written.
+func (bp *BaseProcessor) WriteTeamFiles(groupedData map[int64][][]string, config Config) ([]string, error) {
+	createdFiles := []string{}
+	baseOutputDir := config.Run.Dir()
+
+	planned, err := bp.planTeamFiles(groupedData, config, baseOutputDir)
+	if err != nil {
+		return createdFiles, err
+	}
+
+	failed := make(map[int64]bool)
+	for i, file := range planned {
+		settings := config.SettingsFor(file.TeamID)
+		if failed[file.TeamID] || (settings.Format != "" && settings.Format != FormatCSV) {
+			continue
+		}
+		planned[i].Encoded, err = encodeTeamCSV(file.TeamID, file.Data, settings.CSV)
+		if err != nil {
+			logging.Red("Skipping team %d: %v", file.TeamID, err)
+			ProcessingErrors = append(ProcessingErrors, "Failed to encode files for team "+strconv.FormatInt(file.TeamID, 10)+": "+err.Error())
+			failed[file.TeamID] = true
+		}
+	}
+
+	for _, file := range planned {
+		if failed[file.TeamID] {
+			continue
+		}
+		teamDir := filepath.Dir(file.Path)
+		if err := os.MkdirAll(teamDir, 0755); err != nil {
+			return createdFiles, fmt.Errorf("failed to create output directory '%s' for team %d: %w", teamDir, file.TeamID, err)
+		}
+
+		var fp string
+		settings := config.SettingsFor(file.TeamID)
+		switch format := settings.Format; format {
+		case "", FormatCSV:
+			fp, err = writeCSVData(file.TeamID, file.Encoded, file.Path)
+		case FormatJSONL, FormatJSON:
+			fp, err = bp.WriteJSONFile(file.TeamID, file.Data, file.Path, format)
+		case FormatXLSX:
+			fp, err = bp.WriteXLSXFile(file.TeamID, file.Data, file.Path)
+		default:
+			err = fmt.Errorf("unknown output format %q for team %d", format, file.TeamID)
+		}
+		if err != nil {
+			return createdFiles, err
+		}
+
+		fmt.Printf("Successfully wrote %d data rows for Team %d to: %s\n", len(file.Data)-1, file.TeamID, fp)
+		config.Run.recordFile(fp, RunFile{
+			TeamID:    file.TeamID,
+			Rows:      len(file.Data) - 1,
+			ScanTypes: []string{bp.getScanTypeName()},
+			Fairs:     distinctFairs(file.Data),
+		})
+		createdFiles = append(createdFiles, fp)
+	}
+
+	return createdFiles, nil
+}
+
 // getScanTypeName returns a string representation of the scan type
 func (bp *BaseProcessor) getScanTypeName() string {
 	switch bp.scanTypeID {
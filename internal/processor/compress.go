@@ -0,0 +1,372 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Compression modes accepted in the compression setting
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZip  = "zip"
+)
+
+// bundleFilenameTemplate names the zip holding all of a team's files for a run.
+const bundleFilenameTemplate = "StriveScan-Scans-Export-Bundle_{date}-{time}.{ext}"
+
+// bundleManifestName is the name of the manifest stored inside zip bundles.
+const bundleManifestName = "manifest.json"
+
+// WinZip AES (AE-2) parameters. Keys are always 256-bit.
+const (
+	zipMethodAES      = 99
+	zipExtraAES       = 0x9901
+	zipAESStrength    = 3 // AES-256
+	zipAESKeyLen      = 32
+	zipAESSaltLen     = 16
+	zipAESIterations  = 1000
+	zipAESAuthCodeLen = 10
+)
+
+// bundleManifest describes the contents of a zip bundle.
+type bundleManifest struct {
+	TeamID      int64                `json:"team_id"`
+	GeneratedAt string               `json:"generated_at"`
+	Files       []bundleManifestFile `json:"files"`
+}
+
+type bundleManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// validateCompression checks the compression settings for consistency.
+func validateCompression(mode string, encrypt bool) error {
+	switch mode {
+	case CompressionNone, CompressionGzip, CompressionZip:
+	default:
+		return fmt.Errorf("unknown compression %q", mode)
+	}
+	if encrypt && mode != CompressionZip {
+		return fmt.Errorf("zip_encrypt requires compression \"zip\"")
+	}
+	return nil
+}
+
+// gzipFiles compresses each file to path.gz and removes the original. The
+// returned list holds the compressed paths. Files that are already compressed
+// are passed through.
+func gzipFiles(files []string) ([]string, error) {
+	compressed := make([]string, 0, len(files))
+	for _, path := range files {
+		if isPrepared(path, ".gz") {
+			compressed = append(compressed, path)
+			continue
+		}
+
+		out := path + ".gz"
+		if err := gzipFile(path, out); err != nil {
+			os.Remove(out)
+			return nil, fmt.Errorf("failed to gzip %s: %w", path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		compressed = append(compressed, out)
+	}
+	return compressed, nil
+}
+
+func gzipFile(in string, out string) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(in)
+	zw.ModTime = time.Now()
+	if _, err := io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// bundleFiles writes every file plus a manifest into a single zip in dir and
+// removes the originals, so the team receives one delivery per run. The zip is
+// named with the team's filename template, or bundleFilenameTemplate if it has
+// none, with {scan_type} BUNDLE and {fair} all. When password is non-empty the
+// entries are WinZip AES-256 encrypted.
+func bundleFiles(files []string, dir string, teamID int64, tmpl string, runID string, password []byte) (string, error) {
+	if tmpl == "" {
+		tmpl = bundleFilenameTemplate
+	}
+	now := time.Now()
+	vars := filenameVars{Team: teamID, ScanType: "BUNDLE", Fair: "all", RunID: runID, Seq: 1, Ext: "zip", Time: now}
+
+	var out string
+	for {
+		name, err := renderFilename(tmpl, vars)
+		if err != nil {
+			return "", err
+		}
+		out = filepath.Join(dir, name)
+		if _, err := os.Stat(out); err != nil || !strings.Contains(tmpl, "{seq") {
+			break
+		}
+		vars.Seq++
+	}
+
+	if err := writeBundle(out, files, teamID, password, now); err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			os.Remove(out)
+		}
+		return "", fmt.Errorf("failed to write zip bundle: %w", err)
+	}
+
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return out, nil
+}
+
+func writeBundle(out string, files []string, teamID int64, password []byte, now time.Time) error {
+	dst, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	zw := zip.NewWriter(dst)
+	manifest := bundleManifest{
+		TeamID:      teamID,
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		Files:       []bundleManifestFile{},
+	}
+
+	for _, path := range files {
+		name := filepath.Base(path)
+		entry, err := addZipFile(zw, path, password, now)
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addZipEntry(zw, bundleManifestName, bytes.NewReader(manifestData), password, now); err != nil {
+		return fmt.Errorf("failed to add %s: %w", bundleManifestName, err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// addZipFile streams the file at path into the zip, hashing it on the way for
+// the manifest.
+func addZipFile(zw *zip.Writer, path string, password []byte, modified time.Time) (bundleManifestFile, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return bundleManifestFile{}, err
+	}
+	defer src.Close()
+
+	h := sha256.New()
+	counter := &countingWriter{w: h}
+	if err := addZipEntry(zw, filepath.Base(path), io.TeeReader(src, counter), password, modified); err != nil {
+		return bundleManifestFile{}, err
+	}
+	return bundleManifestFile{
+		Name:   filepath.Base(path),
+		Size:   counter.n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// addZipEntry streams src into a new entry. The header of an encrypted entry
+// records its compressed size, so the data is compressed to a temporary file
+// first and then encrypted from there. The temporary file is kept out of the
+// output directory so a crash can't leave it to be uploaded.
+func addZipEntry(zw *zip.Writer, name string, src io.Reader, password []byte, modified time.Time) error {
+	if len(password) == 0 {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, src)
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "strivescan-bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	fw, err := flate.NewWriter(tmp, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(fw, src)
+	if err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	compressedSize, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// AE-2 entries carry no CRC; integrity comes from the authentication code.
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraAES)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], 2) // AE-2
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zipMethodAES,
+		Flags:              0x1, // encrypted
+		CompressedSize64:   uint64(zipAESSaltLen + 2 + compressedSize + zipAESAuthCodeLen),
+		UncompressedSize64: uint64(size),
+		Extra:              extra,
+	}
+	fh.SetModTime(modified)
+
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	aw, err := newWinZipAESWriter(w, password)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(aw, tmp); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// winZipAESWriter encrypts in the WinZip AES format: salt, password verifier,
+// AES-CTR ciphertext with a little-endian counter starting at 1, then a
+// truncated HMAC-SHA1 over the ciphertext.
+type winZipAESWriter struct {
+	w         io.Writer
+	block     cipher.Block
+	mac       hash.Hash
+	counter   uint64
+	keystream [aes.BlockSize]byte
+	used      int // Bytes of keystream already consumed
+}
+
+// newWinZipAESWriter writes the salt and password verifier to w and returns a
+// writer that encrypts what follows.
+func newWinZipAESWriter(w io.Writer, password []byte) (*winZipAESWriter, error) {
+	salt := make([]byte, zipAESSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	derived := pbkdf2.Key(password, salt, zipAESIterations, 2*zipAESKeyLen+2, sha1.New)
+	block, err := aes.NewCipher(derived[:zipAESKeyLen])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(derived[2*zipAESKeyLen:]); err != nil {
+		return nil, err
+	}
+	return &winZipAESWriter{
+		w:     w,
+		block: block,
+		mac:   hmac.New(sha1.New, derived[zipAESKeyLen:2*zipAESKeyLen]),
+		used:  aes.BlockSize,
+	}, nil
+}
+
+func (a *winZipAESWriter) Write(p []byte) (int, error) {
+	ciphertext := make([]byte, len(p))
+	for i, b := range p {
+		if a.used == aes.BlockSize {
+			a.counter++
+			var counter [aes.BlockSize]byte
+			binary.LittleEndian.PutUint64(counter[:], a.counter)
+			a.block.Encrypt(a.keystream[:], counter[:])
+			a.used = 0
+		}
+		ciphertext[i] = b ^ a.keystream[a.used]
+		a.used++
+	}
+	a.mac.Write(ciphertext)
+	return a.w.Write(ciphertext)
+}
+
+// Close writes the authentication code. It does not close the underlying writer.
+func (a *winZipAESWriter) Close() error {
+	_, err := a.w.Write(a.mac.Sum(nil)[:zipAESAuthCodeLen])
+	return err
+}
@@ -0,0 +1,229 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// CSV dialect values accepted in the csv settings
+const (
+	QuotingMinimal = "minimal"
+	QuotingAll     = "all"
+
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+
+	EncodingUTF8        = "utf-8"
+	EncodingWindows1252 = "windows-1252"
+)
+
+// utf8BOM is the UTF-8 byte order mark some importers need to detect the encoding.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// validateCSVDialect checks that a team's CSV dialect can be written.
+func validateCSVDialect(d models.CSVDialect) error {
+	if d.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(d.Delimiter)
+		if size != len(d.Delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return fmt.Errorf("invalid CSV delimiter %q", d.Delimiter)
+		}
+	}
+
+	switch d.Quoting {
+	case "", QuotingMinimal, QuotingAll:
+	default:
+		return fmt.Errorf("unknown CSV quoting %q", d.Quoting)
+	}
+
+	switch d.LineEnding {
+	case "", LineEndingLF, LineEndingCRLF:
+	default:
+		return fmt.Errorf("unknown CSV line ending %q", d.LineEnding)
+	}
+
+	switch d.Encoding {
+	case "", EncodingUTF8:
+	case EncodingWindows1252:
+		if d.BOM {
+			return fmt.Errorf("a byte order mark can only be written with %s encoding", EncodingUTF8)
+		}
+		if d.Delimiter != "" {
+			if _, ok := charmap.Windows1252.EncodeRune([]rune(d.Delimiter)[0]); !ok {
+				return fmt.Errorf("CSV delimiter %q cannot be encoded in %s", d.Delimiter, EncodingWindows1252)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown CSV encoding %q", d.Encoding)
+	}
+
+	return nil
+}
+
+// encodeCSV renders the records in the given dialect, returning the bytes to
+// write. Every cell is checked before anything is returned, so a record that
+// can't be encoded never produces a partial file.
+func encodeCSV(records [][]string, d models.CSVDialect) ([]byte, error) {
+	records = nullsAsEmpty(records)
+	if d.Encoding == EncodingWindows1252 {
+		prepared, err := prepareWindows1252(records, d.Transliterate)
+		if err != nil {
+			return nil, err
+		}
+		records = prepared
+	}
+
+	var buf bytes.Buffer
+	if d.BOM {
+		buf.Write(utf8BOM)
+	}
+
+	comma := ','
+	if d.Delimiter != "" {
+		comma = []rune(d.Delimiter)[0]
+	}
+	useCRLF := d.LineEnding == LineEndingCRLF
+
+	if d.Quoting == QuotingAll {
+		writeQuotedCSV(&buf, records, comma, useCRLF)
+	} else {
+		writer := csv.NewWriter(&buf)
+		writer.Comma = comma
+		writer.UseCRLF = useCRLF
+		if err := writer.WriteAll(records); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Encoding == EncodingWindows1252 {
+		return encodeWindows1252(buf.String()), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// nullsAsEmpty replaces NULL cells with empty strings, copying only the rows
+// that contain one.
+func nullsAsEmpty(records [][]string) [][]string {
+	var cleaned [][]string
+	for i, record := range records {
+		if !slices.Contains(record, nullCell) {
+			continue
+		}
+		if cleaned == nil {
+			cleaned = slices.Clone(records)
+		}
+		row := make([]string, len(record))
+		for j, cell := range record {
+			row[j] = cellText(cell)
+		}
+		cleaned[i] = row
+	}
+	if cleaned == nil {
+		return records
+	}
+	return cleaned
+}
+
+// writeQuotedCSV writes records with every field quoted, which encoding/csv
+// does not support.
+func writeQuotedCSV(w io.Writer, records [][]string, comma rune, useCRLF bool) {
+	lineEnd := "\n"
+	if useCRLF {
+		lineEnd = "\r\n"
+	}
+	for _, record := range records {
+		var line strings.Builder
+		for i, field := range record {
+			if i > 0 {
+				line.WriteRune(comma)
+			}
+			field = strings.ReplaceAll(field, `"`, `""`)
+			if useCRLF {
+				field = strings.ReplaceAll(strings.ReplaceAll(field, "\r\n", "\n"), "\n", "\r\n")
+			}
+			line.WriteByte('"')
+			line.WriteString(field)
+			line.WriteByte('"')
+		}
+		line.WriteString(lineEnd)
+		io.WriteString(w, line.String())
+	}
+}
+
+// prepareWindows1252 returns a copy of the records in which every character can
+// be encoded in Windows-1252, transliterating where allowed. The first cell
+// that still can't be encoded is reported by its 1-based data row, not
+// counting the header, and its column.
+func prepareWindows1252(records [][]string, transliterate bool) ([][]string, error) {
+	prepared := make([][]string, len(records))
+	for r, record := range records {
+		prepared[r] = make([]string, len(record))
+		for c, field := range record {
+			var out strings.Builder
+			// Compose first so a letter followed by a combining accent is
+			// kept as the accented letter Windows-1252 has
+			for _, ch := range norm.NFC.String(field) {
+				if _, ok := charmap.Windows1252.EncodeRune(ch); ok {
+					out.WriteRune(ch)
+					continue
+				}
+				if replacement, ok := transliterateWindows1252(ch); ok && transliterate {
+					out.WriteString(replacement)
+					continue
+				}
+				column := fmt.Sprintf("%d", c+1)
+				if len(records) > 0 && c < len(records[0]) {
+					column = fmt.Sprintf("%q", records[0][c])
+				}
+				row := "header"
+				if r > 0 {
+					row = fmt.Sprintf("data row %d", r)
+				}
+				return nil, fmt.Errorf("%s, column %s: character %q (%U) cannot be encoded in %s", row, column, ch, ch, EncodingWindows1252)
+			}
+			prepared[r][c] = out.String()
+		}
+	}
+	return prepared, nil
+}
+
+// stripMarks decomposes text and drops the combining marks, leaving the base
+// letters: "ą" becomes "a".
+var stripMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)))
+
+// transliterateWindows1252 approximates a character Windows-1252 can't
+// represent by its base letter without accents, if that can be encoded.
+func transliterateWindows1252(ch rune) (string, bool) {
+	stripped, _, err := transform.String(stripMarks, string(ch))
+	if err != nil || stripped == "" || stripped == string(ch) {
+		return "", false
+	}
+	for _, r := range stripped {
+		if _, ok := charmap.Windows1252.EncodeRune(r); !ok {
+			return "", false
+		}
+	}
+	return stripped, true
+}
+
+// encodeWindows1252 converts text that has passed prepareWindows1252 to bytes.
+func encodeWindows1252(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, ch := range s {
+		b, _ := charmap.Windows1252.EncodeRune(ch)
+		out = append(out, b)
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+func TestPrepareWindows1252ReportsDataRow(t *testing.T) {
+	records := [][]string{
+		{"First Name", "Last Name"},
+		{"Ada", "Lovelace"},
+		{"Zhang", "伟"},
+	}
+	_, err := prepareWindows1252(records, true)
+	if err == nil {
+		t.Fatal("expected an encoding error")
+	}
+	if want := `data row 2, column "Last Name"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not mention %s", err, want)
+	}
+
+	_, err = prepareWindows1252([][]string{{"名前"}, {"Ada"}}, false)
+	if err == nil || !strings.HasPrefix(err.Error(), "header, column") {
+		t.Errorf("error %v does not name the header", err)
+	}
+}
+
+func TestWriteTeamFilesSkipsTeamThatCannotBeEncoded(t *testing.T) {
+	root := t.TempDir()
+	cp1252 := models.SFTPSettings{CSV: models.CSVDialect{Encoding: EncodingWindows1252}}
+	perFair := models.SFTPSettings{CSV: cp1252.CSV, FilenameTemplate: "{fair}.{ext}"}
+	config := Config{
+		Run:          NewRun(root),
+		TeamSettings: map[int64]models.SFTPSettings{1: cp1252, 2: perFair, 3: cp1252},
+	}
+	groupedData := map[int64][][]string{
+		1: {{"Fair Name", "First Name"}, {"Boston", "Zoë"}},
+		2: {{"Fair Name", "First Name"}, {"Boston", "Ada"}, {"Chicago", "伟"}},
+		3: {{"Fair Name", "First Name"}, {"Boston", "Grace"}},
+	}
+
+	errStart := len(ProcessingErrors)
+	defer func() { ProcessingErrors = ProcessingErrors[:errStart] }()
+
+	bp := NewBaseProcessor(1)
+	files, err := bp.WriteTeamFiles(groupedData, config)
+	if err != nil {
+		t.Fatalf("WriteTeamFiles: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("wrote %v, want the files of teams 1 and 3", files)
+	}
+	for _, fp := range files {
+		if rel, _ := filepath.Rel(config.Run.Dir(), fp); strings.HasPrefix(rel, "2"+string(filepath.Separator)) {
+			t.Errorf("team 2 wrote %s although one of its files can't be encoded", fp)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(config.Run.Dir(), "2")); !os.IsNotExist(err) {
+		t.Error("team 2's directory was created although none of its files were written")
+	}
+
+	reported := ProcessingErrors[errStart:]
+	if len(reported) != 1 || !strings.Contains(reported[0], "team 2") {
+		t.Errorf("ProcessingErrors = %q, want one error for team 2", reported)
+	}
+}
+
+func TestEncodeCSVWritesNullAsEmpty(t *testing.T) {
+	records := [][]string{{"First Name", "Last Name"}, {"Ada", nullCell}}
+	for _, dialect := range []models.CSVDialect{{}, {Encoding: EncodingWindows1252}, {Quoting: QuotingAll}} {
+		data, err := encodeCSV(records, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), nullCell) {
+			t.Errorf("dialect %+v wrote the NULL marker: %q", dialect, data)
+		}
+	}
+	if records[1][1] != nullCell {
+		t.Error("encodeCSV modified its input")
+	}
+}
+
+func TestEncodeCSVWindows1252(t *testing.T) {
+	records := [][]string{{"Name", "Price"}, {"Nguyễn Thị Ánh", "€5"}, {"Zoe\u0308", "“quoted”"}}
+	data, err := encodeCSV(records, models.CSVDialect{Encoding: EncodingWindows1252, Transliterate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Name,Price\nNguyen Thi \xc1nh,\x805\nZo\xeb,\x93quoted\x94\n"
+	if string(data) != want {
+		t.Errorf("encodeCSV = %q, want %q", data, want)
+	}
+
+	if _, err := encodeCSV(records, models.CSVDialect{Encoding: EncodingWindows1252}); err == nil {
+		t.Error("expected an error for ễ without transliteration")
+	}
+	for _, name := range []string{"伟", "Łukasz"} {
+		_, err := encodeCSV([][]string{{"Name"}, {name}}, models.CSVDialect{Encoding: EncodingWindows1252, Transliterate: true})
+		if err == nil {
+			t.Errorf("expected %q, which has no unaccented form, to fail", name)
+		}
+	}
+}
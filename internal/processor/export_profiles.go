@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// Export profile names accepted by the -profile flag.
+const (
+	ProfileStandard = "standard" // Per scan type layout defined by each processor
+	ProfileFull     = "full"     // Every fetched StudentScanData field
+	ProfileSlate    = "slate"    // Technolutions Slate source format
+)
+
+// ExportColumn describes a single output column of an export profile.
+type ExportColumn struct {
+	Header string
+	Value  func(r *exportRecord) string
+}
+
+// ExportProfile is a fixed column layout applied to scan data regardless of the
+// scan type it was fetched for.
+type ExportProfile struct {
+	Name    string
+	Columns []ExportColumn
+	// Key, if set, collapses rows sharing the same key within a team so each
+	// one appears once. The most recently seen row wins.
+	Key func(scan models.StudentScanData) string
+}
+
+// exportRecord wraps a scan while a profile row is built so that derived views
+// of it are only computed once per row.
+type exportRecord struct {
+	Scan     models.StudentScanData
+	standard map[string]string
+	full     map[string]string
+}
+
+// Standard returns the value of a column from the standard US layout produced
+// by BaseProcessor.TransformScanToRow, keyed by its CSV header.
+func (r *exportRecord) Standard(header string) string {
+	if r.standard == nil {
+		r.standard = zipRow(profileFormatter.GetCSVHeader(), profileFormatter.TransformScanToRow(r.Scan))
+	}
+	return r.standard[header]
+}
+
+// Field returns the value of a full profile column, keyed by its snake_case header.
+func (r *exportRecord) Field(name string) string {
+	if r.full == nil {
+		r.full = zipRow(fullProfile.Header(), fullProfile.TransformScanToRow(r.Scan))
+	}
+	return r.full[name]
+}
+
+func zipRow(header []string, row []string) map[string]string {
+	values := make(map[string]string, len(header))
+	for i, h := range header {
+		values[h] = row[i]
+	}
+	return values
+}
+
+// profileFormatter provides the shared nullable-type helpers to profile columns.
+var profileFormatter = NewBaseProcessor(0)
+
+// fullProfile is shared by every exportRecord that needs full profile values.
+var fullProfile = FullExportProfile()
+
+// GetExportProfile returns the profile registered under name. The standard
+// profile has no fixed layout and returns nil.
+func GetExportProfile(name string) (*ExportProfile, error) {
+	switch name {
+	case "", ProfileStandard:
+		return nil, nil
+	case ProfileFull:
+		return FullExportProfile(), nil
+	case ProfileSlate:
+		return SlateExportProfile(), nil
+	default:
+		return nil, fmt.Errorf("unknown export profile %q", name)
+	}
+}
+
+// Header returns the header row for the profile.
+func (p *ExportProfile) Header() []string {
+	header := make([]string, len(p.Columns))
+	for i, col := range p.Columns {
+		header[i] = col.Header
+	}
+	return header
+}
+
+// TransformScanToRow converts a scan data record to a row using the profile's columns.
+func (p *ExportProfile) TransformScanToRow(scan models.StudentScanData) []string {
+	record := &exportRecord{Scan: scan}
+	row := make([]string, len(p.Columns))
+	for i, col := range p.Columns {
+		row[i] = col.Value(record)
+	}
+	return row
+}
+
+// TransformData groups scan data by TeamID using the profile's layout.
+func (p *ExportProfile) TransformData(data interface{}) (map[int64][][]string, error) {
+	fmt.Printf("Transforming and grouping scan data by TeamID using the %s profile...\n", p.Name)
+	scans, ok := data.([]models.StudentScanData)
+	if !ok {
+		return nil, fmt.Errorf("invalid data type for %s profile transformation, expected []models.StudentScanData", p.Name)
+	}
+
+	groupedData := make(map[int64][][]string)
+	keyIndex := make(map[int64]map[string]int) // team -> row key -> row index
+	for _, scan := range scans {
+		teamData, exists := groupedData[scan.TeamID]
+		if !exists {
+			teamData = [][]string{p.Header()}
+			keyIndex[scan.TeamID] = make(map[string]int)
+		}
+		row := p.TransformScanToRow(scan)
+		if p.Key != nil {
+			key := p.Key(scan)
+			if idx, seen := keyIndex[scan.TeamID][key]; seen {
+				teamData[idx] = row
+				continue
+			}
+			keyIndex[scan.TeamID][key] = len(teamData)
+		}
+		teamData = append(teamData, row)
+		groupedData[scan.TeamID] = teamData
+	}
+
+	fmt.Printf("Data grouped into %d teams.\n", len(groupedData))
+	return groupedData, nil
+}
+
+// FullExportProfile returns the profile containing every field fetched into
+// models.StudentScanData, in struct order, with snake_case headers matching the
+// query column aliases.
+func FullExportProfile() *ExportProfile {
+	return &ExportProfile{
+		Name: ProfileFull,
+		Columns: []ExportColumn{
+			intColumn("team_id", func(s models.StudentScanData) int64 { return s.TeamID }),
+			textColumn("team_name", func(s models.StudentScanData) string { return s.TeamName }),
+			stringColumn("internal_event_id", func(s models.StudentScanData) sql.NullString { return s.InternalEventID }),
+			intColumn("fair_id", func(s models.StudentScanData) int64 { return s.FairID }),
+			textColumn("fair_name", func(s models.StudentScanData) string { return s.FairName }),
+			timeColumn("fair_date", func(s models.StudentScanData) sql.NullTime { return s.FairDate }),
+			intColumn("student_id", func(s models.StudentScanData) int64 { return s.StudentID }),
+			stringColumn("first_name", func(s models.StudentScanData) sql.NullString { return s.FirstName }),
+			stringColumn("last_name", func(s models.StudentScanData) sql.NullString { return s.LastName }),
+			stringColumn("email", func(s models.StudentScanData) sql.NullString { return s.Email }),
+			stringColumn("phone", func(s models.StudentScanData) sql.NullString { return s.Phone }),
+			stringColumn("phone_number", func(s models.StudentScanData) sql.NullString { return s.PhoneNumber }),
+			stringColumn("phone_number_formatted", func(s models.StudentScanData) sql.NullString { return s.PhoneNumberFormatted }),
+			stringColumn("address_line_1", func(s models.StudentScanData) sql.NullString { return s.AddressLine1 }),
+			stringColumn("address_line_2", func(s models.StudentScanData) sql.NullString { return s.AddressLine2 }),
+			stringColumn("address_city", func(s models.StudentScanData) sql.NullString { return s.AddressCity }),
+			stringColumn("address_state", func(s models.StudentScanData) sql.NullString { return s.AddressState }),
+			stringColumn("address_zipcode", func(s models.StudentScanData) sql.NullString { return s.AddressZipcode }),
+			stringColumn("address_country_code", func(s models.StudentScanData) sql.NullString { return s.AddressCountryCode }),
+			stringColumn("high_school", func(s models.StudentScanData) sql.NullString { return s.HighSchool }),
+			stringColumn("graduation_year", func(s models.StudentScanData) sql.NullString { return s.GraduationYear }),
+			stringColumn("gpa", func(s models.StudentScanData) sql.NullString { return s.GPA }),
+			stringColumn("area_of_interest_1", func(s models.StudentScanData) sql.NullString { return s.AreaOfInterest1 }),
+			stringColumn("area_of_interest_2", func(s models.StudentScanData) sql.NullString { return s.AreaOfInterest2 }),
+			stringColumn("area_of_interest_3", func(s models.StudentScanData) sql.NullString { return s.AreaOfInterest3 }),
+			stringColumn("birthdate", func(s models.StudentScanData) sql.NullString { return s.Birthdate }),
+			stringColumn("sat_score", func(s models.StudentScanData) sql.NullString { return s.SatScore }),
+			stringColumn("act_score", func(s models.StudentScanData) sql.NullString { return s.ActScore }),
+			stringColumn("text_permission", func(s models.StudentScanData) sql.NullString { return s.TextPermission }),
+			stringColumn("high_school_city", func(s models.StudentScanData) sql.NullString { return s.HighSchoolCity }),
+			stringColumn("high_school_region", func(s models.StudentScanData) sql.NullString { return s.HighSchoolRegion }),
+			stringColumn("college_start_semester", func(s models.StudentScanData) sql.NullString { return s.CollegeStartSemester }),
+			stringColumn("gpa_max", func(s models.StudentScanData) sql.NullString { return s.GPAMax }),
+			stringColumn("grad_type", func(s models.StudentScanData) sql.NullString { return s.GradType }),
+			stringColumn("ceeb", func(s models.StudentScanData) sql.NullString { return s.CEEB }),
+			stringColumn("has_hispanic_latino_origin", func(s models.StudentScanData) sql.NullString { return s.HasHispanicLatinoOrigin }),
+			stringColumn("current_year_class", func(s models.StudentScanData) sql.NullString { return s.CurrentYearClass }),
+			stringColumn("high_school_country", func(s models.StudentScanData) sql.NullString { return s.HighSchoolCountry }),
+			stringColumn("country_of_citizenship_1", func(s models.StudentScanData) sql.NullString { return s.CountryOfCitizenship1 }),
+			stringColumn("country_of_citizenship_2", func(s models.StudentScanData) sql.NullString { return s.CountryOfCitizenship2 }),
+			stringColumn("country_of_citizenship_3", func(s models.StudentScanData) sql.NullString { return s.CountryOfCitizenship3 }),
+			stringColumn("gender", func(s models.StudentScanData) sql.NullString { return s.Gender }),
+			stringColumn("guidance_counselor_first_name", func(s models.StudentScanData) sql.NullString { return s.GuidanceCounselorFirstName }),
+			stringColumn("guidance_counselor_last_name", func(s models.StudentScanData) sql.NullString { return s.GuidanceCounselorLastName }),
+			stringColumn("guidance_counselor_email", func(s models.StudentScanData) sql.NullString { return s.GuidanceCounselorEmail }),
+			stringColumn("country_of_interest_1", func(s models.StudentScanData) sql.NullString { return s.CountryOfInterest1 }),
+			stringColumn("country_of_interest_2", func(s models.StudentScanData) sql.NullString { return s.CountryOfInterest2 }),
+			stringColumn("country_of_interest_3", func(s models.StudentScanData) sql.NullString { return s.CountryOfInterest3 }),
+			stringColumn("authorize_cis", func(s models.StudentScanData) sql.NullString { return s.AuthorizeCIS }),
+			stringColumn("toefl_score", func(s models.StudentScanData) sql.NullString { return s.TOEFLScore }),
+			stringColumn("ielts_score", func(s models.StudentScanData) sql.NullString { return s.IELTSScore }),
+			stringColumn("ssat_score", func(s models.StudentScanData) sql.NullString { return s.SSATScore }),
+			stringColumn("professional_type", func(s models.StudentScanData) sql.NullString { return s.ProfessionalType }),
+			stringColumn("preferred_name", func(s models.StudentScanData) sql.NullString { return s.PreferredName }),
+			stringColumn("pronouns", func(s models.StudentScanData) sql.NullString { return s.Pronouns }),
+			stringColumn("job_title", func(s models.StudentScanData) sql.NullString { return s.JobTitle }),
+			stringColumn("work_phone", func(s models.StudentScanData) sql.NullString { return s.WorkPhone }),
+			stringColumn("work_phone_ext", func(s models.StudentScanData) sql.NullString { return s.WorkPhoneExt }),
+			stringColumn("work_phone_country_code", func(s models.StudentScanData) sql.NullString { return s.WorkPhoneCountryCode }),
+			stringColumn("organization", func(s models.StudentScanData) sql.NullString { return s.Organization }),
+			stringColumn("additional_data_1", func(s models.StudentScanData) sql.NullString { return s.AdditionalData1 }),
+			stringColumn("additional_data_2", func(s models.StudentScanData) sql.NullString { return s.AdditionalData2 }),
+			stringColumn("additional_data_3", func(s models.StudentScanData) sql.NullString { return s.AdditionalData3 }),
+			stringColumn("additional_data_4", func(s models.StudentScanData) sql.NullString { return s.AdditionalData4 }),
+			stringColumn("additional_data_5", func(s models.StudentScanData) sql.NullString { return s.AdditionalData5 }),
+			stringColumn("additional_data_6", func(s models.StudentScanData) sql.NullString { return s.AdditionalData6 }),
+			stringColumn("additional_data_7", func(s models.StudentScanData) sql.NullString { return s.AdditionalData7 }),
+			stringColumn("additional_data_8", func(s models.StudentScanData) sql.NullString { return s.AdditionalData8 }),
+			stringColumn("additional_data_9", func(s models.StudentScanData) sql.NullString { return s.AdditionalData9 }),
+			stringColumn("additional_data_10", func(s models.StudentScanData) sql.NullString { return s.AdditionalData10 }),
+			stringColumn("parent_first_name", func(s models.StudentScanData) sql.NullString { return s.ParentFirstName }),
+			stringColumn("parent_last_name", func(s models.StudentScanData) sql.NullString { return s.ParentLastName }),
+			stringColumn("parent_phone", func(s models.StudentScanData) sql.NullString { return s.ParentPhone }),
+			stringColumn("parent_phone_country_code", func(s models.StudentScanData) sql.NullString { return s.ParentPhoneCountryCode }),
+			stringColumn("parent_email", func(s models.StudentScanData) sql.NullString { return s.ParentEmail }),
+			stringColumn("parent_relationship", func(s models.StudentScanData) sql.NullString { return s.ParentRelationship }),
+			stringColumn("notes", func(s models.StudentScanData) sql.NullString { return s.Notes }),
+			nullIntColumn("rating", func(s models.StudentScanData) sql.NullInt64 { return s.Rating }),
+			boolColumn("follow_up", func(s models.StudentScanData) sql.NullBool { return s.FollowUp }),
+			stringColumn("ethnicity_cuban", func(s models.StudentScanData) sql.NullString { return s.EthnicityCuban }),
+			stringColumn("ethnicity_mexican", func(s models.StudentScanData) sql.NullString { return s.EthnicityMexican }),
+			stringColumn("ethnicity_puerto_rican", func(s models.StudentScanData) sql.NullString { return s.EthnicityPuertoRican }),
+			stringColumn("ethnicity_other_hispanic_latino_or_spanish", func(s models.StudentScanData) sql.NullString { return s.EthnicityOtherHispanicLatinoOrSpanish }),
+			stringColumn("ethnicity_non_hispanic_latino_or_spanish", func(s models.StudentScanData) sql.NullString { return s.EthnicityNonHispanicLatinoOrSpanish }),
+			stringColumn("race_american_indian_or_alaskan_native", func(s models.StudentScanData) sql.NullString { return s.RaceAmericanIndianOrAlaskanNative }),
+			stringColumn("race_asian", func(s models.StudentScanData) sql.NullString { return s.RaceAsian }),
+			stringColumn("race_black_or_african_american", func(s models.StudentScanData) sql.NullString { return s.RaceBlackOrAfricanAmerican }),
+			stringColumn("race_native_hawaiian_or_other_pacific_islander", func(s models.StudentScanData) sql.NullString { return s.RaceNativeHawaiianOrOtherPacificIslander }),
+			stringColumn("race_white", func(s models.StudentScanData) sql.NullString { return s.RaceWhite }),
+			stringColumn("locale", func(s models.StudentScanData) sql.NullString { return s.Locale }),
+			timeColumn("scan_time", func(s models.StudentScanData) sql.NullTime { return s.ScanTime }),
+			boolColumn("parent_encountered", func(s models.StudentScanData) sql.NullBool { return s.ParentEncountered }),
+			timeColumn("updated_time", func(s models.StudentScanData) sql.NullTime { return s.UpdatedTime }),
+			stringColumn("scan_rep", func(s models.StudentScanData) sql.NullString { return s.ScanRep }),
+			stringColumn("event_guide_favourite", func(s models.StudentScanData) sql.NullString { return s.EventGuideFavourite }),
+		},
+	}
+}
+
+// Column constructors for each field type found in models.StudentScanData
+
+func textColumn(header string, field func(s models.StudentScanData) string) ExportColumn {
+	return ExportColumn{Header: header, Value: func(r *exportRecord) string {
+		return field(r.Scan)
+	}}
+}
+
+func intColumn(header string, field func(s models.StudentScanData) int64) ExportColumn {
+	return ExportColumn{Header: header, Value: func(r *exportRecord) string {
+		return strconv.FormatInt(field(r.Scan), 10)
+	}}
+}
+
+func stringColumn(header string, field func(s models.StudentScanData) sql.NullString) ExportColumn {
+	return ExportColumn{Header: header, Value: func(r *exportRecord) string {
+		return profileFormatter.nullStr(field(r.Scan))
+	}}
+}
+
+func nullIntColumn(header string, field func(s models.StudentScanData) sql.NullInt64) ExportColumn {
+	return ExportColumn{Header: header, Value: func(r *exportRecord) string {
+		return profileFormatter.nullInt(field(r.Scan))
+	}}
+}
+
+func boolColumn(header string, field func(s models.StudentScanData) sql.NullBool) ExportColumn {
+	return ExportColumn{Header: header, Value: func(r *exportRecord) string {
+		return profileFormatter.nullBool(field(r.Scan))
+	}}
+}
+
+func timeColumn(header string, field func(s models.StudentScanData) sql.NullTime) ExportColumn {
+	return ExportColumn{Header: header, Value: func(r *exportRecord) string {
+		return profileFormatter.nullTime(field(r.Scan), "2006-01-02 15:04:05")
+	}}
+}
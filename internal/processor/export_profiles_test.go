@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// TestFullExportProfileCoversEveryField sets each models.StudentScanData field
+// on its own and checks that exactly the column in the same position changes,
+// so adding a field without its column, or out of order, fails here.
+func TestFullExportProfileCoversEveryField(t *testing.T) {
+	profile := FullExportProfile()
+	fields := reflect.TypeOf(models.StudentScanData{})
+	if len(profile.Columns) != fields.NumField() {
+		t.Fatalf("full profile has %d columns but StudentScanData has %d fields", len(profile.Columns), fields.NumField())
+	}
+
+	zeroRow := profile.TransformScanToRow(models.StudentScanData{})
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		var scan models.StudentScanData
+		value := reflect.ValueOf(&scan).Elem().Field(i)
+		switch v := value.Addr().Interface().(type) {
+		case *int64:
+			*v = 7
+		case *string:
+			*v = "x"
+		case *sql.NullString:
+			*v = sql.NullString{String: "x", Valid: true}
+		case *sql.NullInt64:
+			*v = sql.NullInt64{Int64: 7, Valid: true}
+		case *sql.NullBool:
+			*v = sql.NullBool{Bool: true, Valid: true}
+		case *sql.NullTime:
+			*v = sql.NullTime{Time: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC), Valid: true}
+		default:
+			t.Fatalf("field %s has type %s, which this test does not know how to set", field.Name, field.Type)
+		}
+
+		row := profile.TransformScanToRow(scan)
+		for col := range row {
+			changed := row[col] != zeroRow[col]
+			if col == i && !changed {
+				t.Errorf("field %s does not change column %d (%s)", field.Name, col, profile.Columns[col].Header)
+			}
+			if col != i && changed {
+				t.Errorf("field %s changes column %d (%s), want column %d (%s)", field.Name, col, profile.Columns[col].Header, i, profile.Columns[i].Header)
+			}
+		}
+	}
+}
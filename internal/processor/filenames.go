@@ -0,0 +1,264 @@
+package processor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFilenameTemplate reproduces the historical export name with a 24-hour
+// clock so files sort chronologically.
+const DefaultFilenameTemplate = "StriveScan-Scans-Export-{scan_type}_{date}-{time}.{ext}"
+
+// filenamePlaceholder matches {name} and {name:layout} placeholders.
+var filenamePlaceholder = regexp.MustCompile(`\{([a-z_]+)(?::([^}]*))?\}`)
+
+// unsafeFilenameChars matches characters replaced when a value is substituted
+// into a file name.
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fairHeaders are the headers identifying a row's fair, in order of preference.
+var fairHeaders = []string{"Fair Name", "Event", "fair_name"}
+
+// filenameVars holds the values available to a filename template.
+type filenameVars struct {
+	Team     int64
+	ScanType string
+	Fair     string
+	RunID    string
+	Seq      int // 1-based number that makes the name unique in the team's directory
+	Ext      string
+	Time     time.Time
+}
+
+// NewRunID returns an identifier unique to this run, usable in file names.
+func NewRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// validateFilenameTemplate checks a template for unknown placeholders and
+// path separators.
+func validateFilenameTemplate(tmpl string) error {
+	if strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("filename template %q must not contain path separators", tmpl)
+	}
+	_, err := renderFilename(tmpl, filenameVars{Time: time.Now()})
+	return err
+}
+
+// renderFilename expands a filename template. Supported placeholders are
+// {team}, {scan_type}, {fair}, {run_id}, {seq}, {ext}, {date} and {time};
+// {date} and {time} accept a Go layout, e.g. {date:2006-01-02}. {seq} is the
+// lowest number from 001 that gives a name not yet used in the team's output
+// directory, see planTeamFiles. If the template has no {ext} the extension is
+// appended.
+func renderFilename(tmpl string, vars filenameVars) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultFilenameTemplate
+	}
+	if !strings.Contains(tmpl, "{ext}") {
+		tmpl += ".{ext}"
+	}
+
+	var renderErr error
+	name := filenamePlaceholder.ReplaceAllStringFunc(tmpl, func(match string) string {
+		parts := filenamePlaceholder.FindStringSubmatch(match)
+		key, layout := parts[1], parts[2]
+		switch key {
+		case "team":
+			return strconv.FormatInt(vars.Team, 10)
+		case "scan_type":
+			return vars.ScanType
+		case "fair":
+			return sanitizeFilenamePart(vars.Fair)
+		case "run_id":
+			return vars.RunID
+		case "seq":
+			return fmt.Sprintf("%03d", vars.Seq)
+		case "ext":
+			return vars.Ext
+		case "date":
+			if layout == "" {
+				layout = "20060102"
+			}
+			return sanitizeFilenamePart(vars.Time.Format(layout))
+		case "time":
+			if layout == "" {
+				layout = "150405"
+			}
+			return sanitizeFilenamePart(vars.Time.Format(layout))
+		default:
+			renderErr = fmt.Errorf("unknown filename placeholder {%s}", key)
+			return match
+		}
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return name, nil
+}
+
+// sanitizeFilenamePart replaces runs of characters that are unsafe in file names
+// with a single hyphen.
+func sanitizeFilenamePart(s string) string {
+	s = strings.Trim(unsafeFilenameChars.ReplaceAllString(s, "-"), "-")
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// createExportFile creates a new export file, failing rather than overwriting
+// when fp already exists.
+func createExportFile(fp string) (*os.File, error) {
+	file, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("file name collision: %s already exists", fp)
+	}
+	return file, err
+}
+
+// plannedFile is an export file whose path has been reserved but not yet written.
+type plannedFile struct {
+	TeamID  int64
+	Path    string
+	Data    [][]string
+	Encoded []byte // CSV bytes, encoded before any file is written
+}
+
+// planTeamFiles works out every file a write will produce, splitting a team's
+// data per fair when its template uses {fair}. Since each team writes to its
+// own directory, names can only repeat between two fairs of a team whose names
+// sanitize alike, or with a file an earlier write of the run left there. With
+// {seq} in the template the number is raised until the name is free; without
+// it such duplicates are rejected before anything is written. Files are still
+// created exclusively, in case one appears in between. Teams with invalid
+// settings are left out.
+func (bp *BaseProcessor) planTeamFiles(groupedData map[int64][][]string, config Config, baseOutputDir string) ([]plannedFile, error) {
+	teamIDs := make([]int64, 0, len(groupedData))
+	for teamID := range groupedData {
+		teamIDs = append(teamIDs, teamID)
+	}
+	sort.Slice(teamIDs, func(i, j int) bool { return teamIDs[i] < teamIDs[j] })
+
+	now := time.Now()
+	planned := []plannedFile{}
+	seen := make(map[string]string) // Path to the fair it was planned for
+
+	for _, teamID := range teamIDs {
+		if err, invalid := config.InvalidSettings[teamID]; invalid {
+			fmt.Printf("Skipping team %d, whose settings are invalid: %v\n", teamID, err)
+			continue
+		}
+		teamData := groupedData[teamID]
+		settings := config.SettingsFor(teamID)
+		format := settings.Format
+		if format == "" {
+			format = FormatCSV
+		}
+
+		groups := []fairGroup{{Data: teamData}}
+		if strings.Contains(settings.FilenameTemplate, "{fair") {
+			groups = splitByFair(teamData)
+		}
+
+		teamDir := filepath.Join(baseOutputDir, strconv.FormatInt(teamID, 10))
+		hasSeq := strings.Contains(settings.FilenameTemplate, "{seq")
+		seq := 1
+		for _, group := range groups {
+			var fp string
+			for ; ; seq++ {
+				name, err := renderFilename(settings.FilenameTemplate, filenameVars{
+					Team:     teamID,
+					ScanType: bp.getScanTypeName(),
+					Fair:     group.Fair,
+					RunID:    config.RunID(),
+					Seq:      seq,
+					Ext:      format,
+					Time:     now,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to build file name for team %d: %w", teamID, err)
+				}
+				fp = filepath.Join(teamDir, name)
+
+				_, taken := seen[fp]
+				_, statErr := os.Stat(fp)
+				if hasSeq && (taken || statErr == nil) {
+					continue
+				}
+				if otherFair, dup := seen[fp]; dup {
+					return nil, fmt.Errorf("file name collision: team %d's filename template %q names the files for fairs %q and %q both %s; add {seq} to the template", teamID, settings.FilenameTemplate, otherFair, group.Fair, fp)
+				}
+				if statErr == nil {
+					return nil, fmt.Errorf("file name collision: %s already exists; add {seq} to team %d's filename template", fp, teamID)
+				}
+				break
+			}
+			seen[fp] = group.Fair
+
+			planned = append(planned, plannedFile{TeamID: teamID, Path: fp, Data: group.Data})
+		}
+	}
+
+	return planned, nil
+}
+
+// fairGroup is the header plus the rows of one fair.
+type fairGroup struct {
+	Fair string
+	Data [][]string
+}
+
+// splitByFair splits header-first team data into one group per fair, in the
+// order the fairs first appear.
+func splitByFair(teamData [][]string) []fairGroup {
+	if len(teamData) == 0 {
+		return nil
+	}
+	header := teamData[0]
+	fairCol := fairColumn(header)
+	if fairCol < 0 {
+		return []fairGroup{{Data: teamData}}
+	}
+
+	groups := []fairGroup{}
+	index := make(map[string]int)
+	for _, row := range teamData[1:] {
+		fair := ""
+		if fairCol < len(row) {
+			fair = cellText(row[fairCol])
+		}
+		i, ok := index[fair]
+		if !ok {
+			i = len(groups)
+			index[fair] = i
+			groups = append(groups, fairGroup{Fair: fair, Data: [][]string{header}})
+		}
+		groups[i].Data = append(groups[i].Data, row)
+	}
+	return groups
+}
+
+// fairColumn returns the index of the fair column in header, or -1.
+func fairColumn(header []string) int {
+	for _, name := range fairHeaders {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+func TestPlanTeamFilesNamesCollidingFairs(t *testing.T) {
+	config := Config{
+		Run: NewRun(t.TempDir()),
+		TeamSettings: map[int64]models.SFTPSettings{
+			7: {FilenameTemplate: "{team}_{fair}.{ext}"},
+		},
+	}
+	groupedData := map[int64][][]string{
+		7: {{"Fair Name", "First Name"}, {"Boston Fair", "Ada"}, {"Boston/Fair", "Grace"}},
+	}
+
+	_, err := NewBaseProcessor(1).planTeamFiles(groupedData, config, config.Run.Dir())
+	if err == nil {
+		t.Fatal("expected a file name collision")
+	}
+	for _, want := range []string{`"Boston Fair"`, `"Boston/Fair"`, "{seq}"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+
+	config.TeamSettings[7] = models.SFTPSettings{FilenameTemplate: "{team}_{fair}_{seq}.{ext}"}
+	planned, err := NewBaseProcessor(1).planTeamFiles(groupedData, config, config.Run.Dir())
+	if err != nil {
+		t.Fatalf("planTeamFiles with {seq}: %v", err)
+	}
+	if len(planned) != 2 || filepath.Base(planned[0].Path) != "7_Boston-Fair_001.csv" || filepath.Base(planned[1].Path) != "7_Boston-Fair_002.csv" {
+		t.Errorf("planned %+v, want 7_Boston-Fair_001.csv and 7_Boston-Fair_002.csv", planned)
+	}
+}
+
+func TestCreateExportFileDoesNotOverwrite(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(fp, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writeCSVData(1, []byte("new"), fp); err == nil || !strings.Contains(err.Error(), "file name collision") {
+		t.Fatalf("writeCSVData over an existing file: got %v, want a collision", err)
+	}
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "existing" {
+		t.Errorf("existing file was overwritten with %q", data)
+	}
+}
+
+func TestWriteTeamFilesSkipsInvalidSettings(t *testing.T) {
+	config := Config{
+		Run:             NewRun(t.TempDir()),
+		InvalidSettings: map[int64]error{2: errors.New(`unknown output format "pdf"`)},
+	}
+	groupedData := map[int64][][]string{
+		1: {{"Fair Name", "First Name"}, {"Boston", "Ada"}},
+		2: {{"Fair Name", "First Name"}, {"Boston", "Grace"}},
+	}
+
+	files, err := NewBaseProcessor(1).WriteTeamFiles(groupedData, config)
+	if err != nil {
+		t.Fatalf("WriteTeamFiles: %v", err)
+	}
+	if len(files) != 1 || len(config.Run.TeamFiles(1)) != 1 || len(config.Run.TeamFiles(2)) != 0 {
+		t.Errorf("wrote %v, want only team 1's file", files)
+	}
+}
+
+func TestPlanTeamFilesSeqSkipsExistingFiles(t *testing.T) {
+	config := Config{
+		Run: NewRun(t.TempDir()),
+		TeamSettings: map[int64]models.SFTPSettings{
+			7: {FilenameTemplate: "{team}_{seq}.{ext}"},
+			8: {FilenameTemplate: "{team}.{ext}"},
+		},
+	}
+	for _, name := range []string{"7/7_001.csv", "7/7_002.csv", "8/8.csv"} {
+		fp := filepath.Join(config.Run.Dir(), name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte("earlier write"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bp := NewBaseProcessor(1)
+	planned, err := bp.planTeamFiles(map[int64][][]string{7: {{"First Name"}, {"Ada"}}}, config, config.Run.Dir())
+	if err != nil {
+		t.Fatalf("planTeamFiles with {seq}: %v", err)
+	}
+	if len(planned) != 1 || filepath.Base(planned[0].Path) != "7_003.csv" {
+		t.Errorf("planned %+v, want 7_003.csv", planned)
+	}
+
+	_, err = bp.planTeamFiles(map[int64][][]string{8: {{"First Name"}, {"Ada"}}}, config, config.Run.Dir())
+	if err == nil || !strings.Contains(err.Error(), "already exists") || !strings.Contains(err.Error(), "{seq}") {
+		t.Errorf("planTeamFiles without {seq}: got %v, want a collision suggesting {seq}", err)
+	}
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// columnKind identifies how a column's string values are typed in structured
+// output formats.
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindInt
+	kindBool
+	kindTime
+)
+
+// columnKinds lists the non-string columns across the standard and profile
+// layouts, keyed by header. Anything not listed is written as a string.
+var columnKinds = map[string]columnKind{
+	"Rating":             kindInt,
+	"Follow Up":          kindBool,
+	"Scan Time":          kindTime,
+	"Updated Time":       kindTime,
+	"team_id":            kindInt,
+	"fair_id":            kindInt,
+	"student_id":         kindInt,
+	"fair_date":          kindTime,
+	"rating":             kindInt,
+	"follow_up":          kindBool,
+	"scan_time":          kindTime,
+	"parent_encountered": kindBool,
+	"updated_time":       kindTime,
+}
+
+// typedValue converts a cell to the JSON value for its column kind. NULL cells
+// become null, and values that don't parse as their kind, including empty
+// strings, are kept as strings.
+func typedValue(kind columnKind, value string) interface{} {
+	if value == nullCell {
+		return nil
+	}
+
+	switch kind {
+	case kindInt:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case kindBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case kindTime:
+		if t, err := time.Parse("2006-01-02 15:04:05", value); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+// jsonKey converts a header such as "Ethnicity Other Hispanic, Latino, or Spanish"
+// into a snake_case object key.
+func jsonKey(header string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.TrimSpace(header) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+// WriteJSONFile writes the team data as JSON Lines (format "jsonl") or as a
+// single JSON array (format "json"), one object per data row.
+func (bp *BaseProcessor) WriteJSONFile(teamID int64, teamData [][]string, fp string, format string) (string, error) {
+	if len(teamData) <= 1 { // Skip teams with only a header row
+		return "", fmt.Errorf("no data rows for team %d", teamID)
+	}
+
+	file, err := createExportFile(fp)
+	if err != nil {
+		return "", fmt.Errorf("failed to create JSON file '%s' for team %d: %w", fp, teamID, err)
+	}
+	defer file.Close()
+
+	header := teamData[0]
+	keys := make([]string, len(header))
+	kinds := make([]columnKind, len(header))
+	for i, h := range header {
+		keys[i] = jsonKey(h)
+		kinds[i] = columnKinds[h]
+	}
+
+	writer := bufio.NewWriter(file)
+	if format == FormatJSON {
+		writer.WriteString("[\n")
+	}
+	for i, row := range teamData[1:] {
+		record, err := encodeJSONRecord(keys, kinds, row)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode row %d for team %d: %w", i+1, teamID, err)
+		}
+		if format == FormatJSON && i > 0 {
+			writer.WriteString(",\n")
+		}
+		writer.Write(record)
+		if format == FormatJSONL {
+			writer.WriteByte('\n')
+		}
+	}
+	if format == FormatJSON {
+		writer.WriteString("\n]\n")
+	}
+
+	if err := writer.Flush(); err != nil {
+		return "", fmt.Errorf("failed to write JSON data for team %d to '%s': %w", teamID, fp, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to close JSON file '%s' for team %d: %w", fp, teamID, err)
+	}
+
+	return fp, nil
+}
+
+// encodeJSONRecord encodes a row as a JSON object, keeping the column order.
+func encodeJSONRecord(keys []string, kinds []columnKind, row []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+
+		var cell string
+		if i < len(row) {
+			cell = row[i]
+		}
+		v, err := json.Marshal(typedValue(kinds[i], cell))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
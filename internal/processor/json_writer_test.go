@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// jsonTestData returns header-first standard rows for two scans: one with
+// typed values and an empty, non-NULL first name, and one with NULLs.
+func jsonTestData(bp *BaseProcessor) [][]string {
+	filled := models.StudentScanData{
+		FairName:  "Boston",
+		FirstName: sql.NullString{String: "", Valid: true},
+		LastName:  sql.NullString{String: "Lovelace", Valid: true},
+		Rating:    sql.NullInt64{Int64: 4, Valid: true},
+		FollowUp:  sql.NullBool{Bool: true, Valid: true},
+		ScanTime:  sql.NullTime{Time: time.Date(2025, 3, 4, 9, 30, 0, 0, time.UTC), Valid: true},
+	}
+	empty := models.StudentScanData{FairName: "Chicago"}
+	return [][]string{bp.GetCSVHeader(), bp.TransformScanToRow(filled), bp.TransformScanToRow(empty)}
+}
+
+func checkJSONRecords(t *testing.T, records []map[string]interface{}) {
+	t.Helper()
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	filled := records[0]
+	want := map[string]interface{}{
+		"fair_name":  "Boston",
+		"first_name": "",
+		"last_name":  "Lovelace",
+		"rating":     float64(4),
+		"follow_up":  true,
+		"scan_time":  "2025-03-04T09:30:00Z",
+	}
+	for key, value := range want {
+		if filled[key] != value {
+			t.Errorf("%s = %#v, want %#v", key, filled[key], value)
+		}
+	}
+
+	empty := records[1]
+	for _, key := range []string{"first_name", "last_name", "rating", "follow_up", "scan_time", "updated_time"} {
+		value, ok := empty[key]
+		if !ok || value != nil {
+			t.Errorf("%s = %#v (present %v), want null", key, value, ok)
+		}
+	}
+}
+
+func TestWriteJSONLinesFile(t *testing.T) {
+	bp := NewBaseProcessor(1)
+	fp := filepath.Join(t.TempDir(), "scans.jsonl")
+	if _, err := bp.WriteJSONFile(1, jsonTestData(bp), fp, FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, `{"fair_name":`) {
+			t.Errorf("line %q does not keep the column order", line)
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONRecords(t, records)
+}
+
+func TestWriteJSONArrayFile(t *testing.T) {
+	bp := NewBaseProcessor(1)
+	fp := filepath.Join(t.TempDir(), "scans.json")
+	if _, err := bp.WriteJSONFile(1, jsonTestData(bp), fp, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("%s is not a JSON array: %v", data, err)
+	}
+	checkJSONRecords(t, records)
+}
+
+func TestWriteJSONFileSkipsHeaderOnly(t *testing.T) {
+	bp := NewBaseProcessor(1)
+	fp := filepath.Join(t.TempDir(), "scans.json")
+	if _, err := bp.WriteJSONFile(1, [][]string{bp.GetCSVHeader()}, fp, FormatJSON); err == nil {
+		t.Error("expected an error for a team without data rows")
+	}
+	if _, err := os.Stat(fp); !os.IsNotExist(err) {
+		t.Errorf("%s was created for a team without data rows", fp)
+	}
+}
@@ -203,18 +203,5 @@ func (lp *LindenScanProcessor) WriteCSV(groupedData map[int64][][]string, config
 		return []string{}, nil
 	}
 
-	createdFiles := []string{}
-	baseOutputDir := "output"
-	timestamp := time.Now().Format("20060102_150405")
-
-	for teamID, teamData := range groupedData {
-		fp, err := lp.WriteCSVFile(teamID, teamData, baseOutputDir, timestamp)
-		if err != nil {
-			return createdFiles, err
-		}
-		fmt.Printf("Successfully wrote %d data rows for Team %d to: %s\n", len(teamData)-1, teamID, fp)
-		createdFiles = append(createdFiles, fp)
-	}
-
-	return createdFiles, nil
+	return lp.WriteTeamFiles(groupedData, config)
 }
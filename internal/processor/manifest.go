@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Extensions of the delivery bookkeeping files
+const (
+	manifestExtension = ".manifest.json"
+	checksumExtension = ".sha256"
+	doneExtension     = ".done"
+)
+
+// DeliveryManifest describes everything uploaded to a team in one delivery.
+type DeliveryManifest struct {
+	RunID        string         `json:"run_id"`
+	TeamID       int64          `json:"team_id"`
+	SFTPUpdateID int64          `json:"sftp_update_id"`
+	GeneratedAt  string         `json:"generated_at"`
+	ScanTypes    []string       `json:"scan_types"`
+	Fairs        []string       `json:"fairs"`
+	Files        []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes one delivered file. Rows is null when the file was
+// not written by this run.
+type ManifestFile struct {
+	Name      string   `json:"name"`
+	Rows      *int     `json:"rows"`
+	Size      int64    `json:"size"`
+	SHA256    string   `json:"sha256"`
+	ScanTypes []string `json:"scan_types"`
+	Fairs     []string `json:"fairs"`
+}
+
+// deliveryBaseName is the name shared by a delivery's manifest and done file.
+func deliveryBaseName(run *Run) string {
+	id := time.Now().Format("20060102-150405")
+	if run != nil {
+		id = run.ID
+	}
+	return "StriveScan-Delivery-" + id
+}
+
+// fileSHA256 returns the hex SHA-256 and size of a file.
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// buildManifest hashes each file and fills in what the run recorded about it.
+func buildManifest(run *Run, teamID int64, updateID int64, files []string) (DeliveryManifest, error) {
+	manifest := DeliveryManifest{
+		RunID:        run.idOrEmpty(),
+		TeamID:       teamID,
+		SFTPUpdateID: updateID,
+		GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+		ScanTypes:    []string{},
+		Fairs:        []string{},
+		Files:        []ManifestFile{},
+	}
+
+	for _, path := range files {
+		sum, size, err := fileSHA256(path)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+		entry := ManifestFile{
+			Name:      filepath.Base(path),
+			Size:      size,
+			SHA256:    sum,
+			ScanTypes: []string{},
+			Fairs:     []string{},
+		}
+		if file, ok := run.File(path); ok {
+			rows := file.Rows
+			entry.Rows = &rows
+			entry.ScanTypes = mergeSorted(file.ScanTypes, nil)
+			entry.Fairs = mergeSorted(file.Fairs, nil)
+			manifest.ScanTypes = mergeSorted(manifest.ScanTypes, file.ScanTypes)
+			manifest.Fairs = mergeSorted(manifest.Fairs, file.Fairs)
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	return manifest, nil
+}
+
+// writeManifest writes the manifest as JSON into dir and returns its path.
+func writeManifest(manifest DeliveryManifest, dir string, baseName string) (string, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	path := filepath.Join(dir, baseName+manifestExtension)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return path, nil
+}
+
+// writeChecksumSidecar writes a sha256sum-compatible file for path into dir.
+func writeChecksumSidecar(path string, sum string, dir string) (string, error) {
+	sidecar := filepath.Join(dir, filepath.Base(path)+checksumExtension)
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	if err := os.WriteFile(sidecar, []byte(line), 0644); err != nil {
+		return "", fmt.Errorf("failed to write checksum for %s: %w", path, err)
+	}
+	return sidecar, nil
+}
+
+// writeDoneFile writes the trigger file uploaded after everything else. It
+// names the manifest so pollers know what to read.
+func writeDoneFile(dir string, baseName string) (string, error) {
+	path := filepath.Join(dir, baseName+doneExtension)
+	if err := os.WriteFile(path, []byte(baseName+manifestExtension+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write done file: %w", err)
+	}
+	return path, nil
+}
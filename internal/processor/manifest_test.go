@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+func TestAddDeliveryFilesOutsideArchive(t *testing.T) {
+	archiveDir := t.TempDir()
+	export := filepath.Join(archiveDir, "scans.csv.gz")
+	if err := os.WriteFile(export, []byte("compressed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewResendProcessor(nil, 3, t.TempDir(), "2026-10-01")
+	deliveryDir := t.TempDir()
+	settings := models.SFTPSettings{ChecksumSidecars: true}
+	creds := models.SFTPCredentials{TeamID: 3}
+
+	delivery, err := s.addDeliveryFiles([]string{export}, deliveryDir, creds, settings, 11)
+	if err != nil {
+		t.Fatalf("addDeliveryFiles: %v", err)
+	}
+	if len(delivery) != 4 || delivery[0] != export {
+		t.Fatalf("delivery = %v, want the export, its sidecar, the manifest and the done file", delivery)
+	}
+	for _, path := range delivery[1:] {
+		if filepath.Dir(path) != deliveryDir {
+			t.Errorf("%s was not written to the delivery directory", path)
+		}
+	}
+
+	entries, err := os.ReadDir(archiveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("archive directory holds %d files, want only the export", len(entries))
+	}
+}
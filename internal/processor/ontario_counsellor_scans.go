@@ -261,18 +261,5 @@ func (ocp *OntarioCounsellorScanProcessor) WriteCSV(groupedData map[int64][][]st
 		return []string{}, nil
 	}
 
-	createdFiles := []string{}
-	baseOutputDir := "output"
-	timestamp := time.Now().Format("20060102_150405")
-
-	for teamID, teamData := range groupedData {
-		fp, err := ocp.WriteCSVFile(teamID, teamData, baseOutputDir, timestamp)
-		if err != nil {
-			return createdFiles, err
-		}
-		fmt.Printf("Successfully wrote %d data rows for Team %d to: %s\n", len(teamData)-1, teamID, fp)
-		createdFiles = append(createdFiles, fp)
-	}
-
-	return createdFiles, nil
+	return ocp.WriteTeamFiles(groupedData, config)
 }
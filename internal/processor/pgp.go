@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"bytes"
+	_ "crypto/sha256" // Hash algorithms openpgp can negotiate
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// pgpExtension is appended to the name of every encrypted export file.
+const pgpExtension = ".pgp"
+
+// parsePGPKeyRing reads an armored or binary OpenPGP key ring.
+func parsePGPKeyRing(data []byte) (openpgp.EntityList, error) {
+	if block, err := armor.Decode(bytes.NewReader(data)); err == nil {
+		return openpgp.ReadKeyRing(block.Body)
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// loadPGPSigningKey loads our signing key from PGP_SIGNING_KEY_FILE, decrypting
+// it with PGP_SIGNING_KEY_PASSPHRASE if it is protected.
+func loadPGPSigningKey() (*openpgp.Entity, error) {
+	path := os.Getenv("PGP_SIGNING_KEY_FILE")
+	if path == "" {
+		return nil, errors.New("PGP_SIGNING_KEY_FILE environment variable not set")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	keys, err := parsePGPKeyRing(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	if len(keys) == 0 || keys[0].PrivateKey == nil {
+		return nil, errors.New("signing key file does not contain a private key")
+	}
+
+	signer := keys[0]
+	passphrase := []byte(os.Getenv("PGP_SIGNING_KEY_PASSPHRASE"))
+	if signer.PrivateKey.Encrypted {
+		if err := signer.PrivateKey.Decrypt(passphrase); err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+		}
+	}
+	for _, subkey := range signer.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, fmt.Errorf("failed to decrypt signing subkey: %w", err)
+			}
+		}
+	}
+
+	return signer, nil
+}
+
+// encryptFilesPGP encrypts each file to the partner's public key, optionally
+// signing with our key. The plaintext is removed once its encrypted copy is
+// written, and the returned list holds the .pgp paths to upload. Files that
+// are already encrypted are passed through.
+func encryptFilesPGP(files []string, publicKey string, sign bool) ([]string, error) {
+	recipients, err := parsePGPKeyRing([]byte(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse partner public key: %w", err)
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("partner public key is empty")
+	}
+
+	var signer *openpgp.Entity
+	if sign {
+		signer, err = loadPGPSigningKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	encrypted := make([]string, 0, len(files))
+	for _, path := range files {
+		if strings.HasSuffix(path, pgpExtension) {
+			encrypted = append(encrypted, path)
+			continue
+		}
+
+		out := path + pgpExtension
+		if err := encryptFilePGP(path, out, recipients, signer); err != nil {
+			os.Remove(out)
+			return nil, fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove plaintext %s: %w", path, err)
+		}
+		encrypted = append(encrypted, out)
+	}
+
+	return encrypted, nil
+}
+
+func encryptFilePGP(in string, out string, recipients openpgp.EntityList, signer *openpgp.Entity) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	hints := &openpgp.FileHints{IsBinary: true, FileName: filepath.Base(in)}
+	plaintext, err := openpgp.Encrypt(dst, recipients, signer, hints, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(plaintext, src); err != nil {
+		return err
+	}
+	if err := plaintext.Close(); err != nil {
+		return err
+	}
+	return dst.Close()
+}
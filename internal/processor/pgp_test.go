@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestEncryptFilesPGPRoundTrip(t *testing.T) {
+	recipients := []struct {
+		name   string
+		config *packet.Config
+	}{
+		{"rsa", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}},
+		{"curve25519", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519}},
+	}
+
+	for _, tc := range recipients {
+		t.Run(tc.name, func(t *testing.T) {
+			entity, err := openpgp.NewEntity("Partner", "", "partner@example.com", tc.config)
+			if err != nil {
+				t.Fatalf("NewEntity: %v", err)
+			}
+
+			var public bytes.Buffer
+			w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := entity.Serialize(w); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+
+			plaintext := []byte("first_name,last_name\nAda,Lovelace\n")
+			path := filepath.Join(t.TempDir(), "scans.csv")
+			if err := os.WriteFile(path, plaintext, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			encrypted, err := encryptFilesPGP([]string{path}, public.String(), false)
+			if err != nil {
+				t.Fatalf("encryptFilesPGP: %v", err)
+			}
+			if len(encrypted) != 1 || encrypted[0] != path+pgpExtension {
+				t.Fatalf("encrypted files = %v, want [%s]", encrypted, path+pgpExtension)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("plaintext %s was not removed", path)
+			}
+
+			ciphertext, err := os.Open(encrypted[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ciphertext.Close()
+
+			md, err := openpgp.ReadMessage(ciphertext, openpgp.EntityList{entity}, nil, nil)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			got, err := io.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatalf("reading decrypted body: %v", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("decrypted %q, want %q", got, plaintext)
+			}
+			if md.LiteralData.FileName != "scans.csv" {
+				t.Errorf("literal file name = %q, want scans.csv", md.LiteralData.FileName)
+			}
+		})
+	}
+}
+
+// armoredPGPKey serializes an entity's public key, or its private key if
+// private is set, as armored text.
+func armoredPGPKey(t *testing.T, entity *openpgp.Entity, private bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	blockType := openpgp.PublicKeyType
+	if private {
+		blockType = openpgp.PrivateKeyType
+	}
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if private {
+		err = entity.SerializePrivateWithoutSigning(w, nil)
+	} else {
+		err = entity.Serialize(w)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+// setupPGPSigningKey generates our signing key, protected by passphrase if it
+// isn't empty, and points PGP_SIGNING_KEY_FILE at it. It returns the public
+// key partners use to verify signatures.
+func setupPGPSigningKey(t *testing.T, passphrase string) *openpgp.Entity {
+	t.Helper()
+	signer, err := openpgp.NewEntity("StriveScan", "", "sftp@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519})
+	if err != nil {
+		t.Fatalf("NewEntity: %v", err)
+	}
+	public, err := parsePGPKeyRing([]byte(armoredPGPKey(t, signer, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passphrase != "" {
+		if err := signer.EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+			t.Fatalf("EncryptPrivateKeys: %v", err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "signing.asc")
+	if err := os.WriteFile(path, []byte(armoredPGPKey(t, signer, true)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGP_SIGNING_KEY_FILE", path)
+	return public[0]
+}
+
+func TestEncryptFilesPGPSigns(t *testing.T) {
+	partner, err := openpgp.NewEntity("Partner", "", "partner@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519})
+	if err != nil {
+		t.Fatalf("NewEntity: %v", err)
+	}
+	partnerPublic := armoredPGPKey(t, partner, false)
+
+	for _, passphrase := range []string{"", "correct horse battery staple"} {
+		name := "unprotected"
+		if passphrase != "" {
+			name = "passphrase"
+		}
+		t.Run(name, func(t *testing.T) {
+			signer := setupPGPSigningKey(t, passphrase)
+			t.Setenv("PGP_SIGNING_KEY_PASSPHRASE", passphrase)
+
+			plaintext := []byte("first_name,last_name\nAda,Lovelace\n")
+			path := filepath.Join(t.TempDir(), "scans.csv")
+			if err := os.WriteFile(path, plaintext, 0600); err != nil {
+				t.Fatal(err)
+			}
+			encrypted, err := encryptFilesPGP([]string{path}, partnerPublic, true)
+			if err != nil {
+				t.Fatalf("encryptFilesPGP: %v", err)
+			}
+
+			ciphertext, err := os.Open(encrypted[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ciphertext.Close()
+
+			keyring := openpgp.EntityList{partner, signer}
+			md, err := openpgp.ReadMessage(ciphertext, keyring, nil, nil)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			got, err := io.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatalf("reading decrypted body: %v", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("decrypted %q, want %q", got, plaintext)
+			}
+			if !md.IsSigned || md.SignedBy == nil {
+				t.Fatalf("message is not signed by a key in the keyring (signed %v, key id %X)", md.IsSigned, md.SignedByKeyId)
+			}
+			if md.SignatureError != nil {
+				t.Errorf("signature does not verify: %v", md.SignatureError)
+			}
+			if md.SignedBy.Entity.PrimaryKey.KeyId != signer.PrimaryKey.KeyId {
+				t.Errorf("signed by %X, want %X", md.SignedBy.Entity.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+			}
+		})
+	}
+}
+
+func TestEncryptFilesPGPSigningKeyErrors(t *testing.T) {
+	partner, err := openpgp.NewEntity("Partner", "", "partner@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519})
+	if err != nil {
+		t.Fatalf("NewEntity: %v", err)
+	}
+	partnerPublic := armoredPGPKey(t, partner, false)
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+		want  string
+	}{
+		{"key file not set", func(t *testing.T) { t.Setenv("PGP_SIGNING_KEY_FILE", "") }, "PGP_SIGNING_KEY_FILE environment variable not set"},
+		{"key file missing", func(t *testing.T) {
+			t.Setenv("PGP_SIGNING_KEY_FILE", filepath.Join(t.TempDir(), "missing.asc"))
+		}, "failed to read signing key"},
+		{"public key only", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "public.asc")
+			if err := os.WriteFile(path, []byte(partnerPublic), 0600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PGP_SIGNING_KEY_FILE", path)
+		}, "does not contain a private key"},
+		{"wrong passphrase", func(t *testing.T) {
+			setupPGPSigningKey(t, "correct horse battery staple")
+			t.Setenv("PGP_SIGNING_KEY_PASSPHRASE", "wrong")
+		}, "failed to decrypt signing key"},
+		{"passphrase not set", func(t *testing.T) {
+			setupPGPSigningKey(t, "correct horse battery staple")
+			t.Setenv("PGP_SIGNING_KEY_PASSPHRASE", "")
+		}, "failed to decrypt signing key"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup(t)
+			path := filepath.Join(t.TempDir(), "scans.csv")
+			if err := os.WriteFile(path, []byte("first_name\nAda\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := encryptFilesPGP([]string{path}, partnerPublic, true)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("encryptFilesPGP: got %v, want an error containing %q", err, tc.want)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("plaintext was not kept after the signing key failed to load: %v", err)
+			}
+			if _, err := os.Stat(path + pgpExtension); !os.IsNotExist(err) {
+				t.Errorf("%s was written without a signature", path+pgpExtension)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// ppkHeaderPrefix starts every PuTTY private key file.
+const ppkHeaderPrefix = "PuTTY-User-Key-File-"
+
+// ppkFile holds the fields of a PuTTY private key file, format 2 or 3.
+type ppkFile struct {
+	version    int
+	algorithm  string
+	encryption string
+	comment    string
+	public     []byte
+	private    []byte // Encrypted unless encryption is "none"
+	mac        []byte
+	headers    map[string]string // Key derivation parameters (format 3)
+}
+
+// parsePPK decodes a PuTTY PPK key, verifies its MAC and returns a signer.
+// Format 2 derives the AES key with SHA-1 and authenticates with HMAC-SHA-1;
+// format 3 uses Argon2 and HMAC-SHA-256.
+func parsePPK(data []byte, passphrase []byte) (ssh.Signer, error) {
+	f, err := readPPK(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cipherKey, iv, macKey []byte
+	switch f.encryption {
+	case "none":
+		if f.version == 2 {
+			macKey = ppkV2MACKey(nil)
+		}
+	case "aes256-cbc":
+		if len(passphrase) == 0 {
+			return nil, errors.New("the PPK key is passphrase protected but no passphrase is set")
+		}
+		if f.version == 2 {
+			cipherKey = ppkV2CipherKey(passphrase)
+			iv = make([]byte, aes.BlockSize)
+			macKey = ppkV2MACKey(passphrase)
+		} else {
+			derived, err := ppkV3DeriveKeys(f.headers, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PPK encryption %q", f.encryption)
+	}
+
+	private := f.private
+	if cipherKey != nil {
+		if len(private) == 0 || len(private)%aes.BlockSize != 0 {
+			return nil, errors.New("PPK private key is not a whole number of blocks")
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		private = make([]byte, len(f.private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, f.private)
+		defer wipeBytes(private)
+	}
+
+	newHash := sha256.New
+	if f.version == 2 {
+		newHash = sha1.New
+	}
+	if !hmac.Equal(ppkMAC(newHash, macKey, f, private), f.mac) {
+		if cipherKey != nil {
+			return nil, errors.New("the passphrase does not decrypt the PPK key")
+		}
+		return nil, errors.New("PPK key MAC does not match; the file is corrupt")
+	}
+
+	key, err := ppkPrivateKey(f.algorithm, f.public, private)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), f.public) {
+		return nil, errors.New("PPK private key does not match its public key")
+	}
+	return signer, nil
+}
+
+// readPPK splits a PPK file into its headers and decodes the key blobs.
+func readPPK(data []byte) (*ppkFile, error) {
+	f := &ppkFile{headers: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	next := func() (string, string, error) {
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if line == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(line, ": ")
+			if !ok {
+				return "", "", fmt.Errorf("malformed PPK line %q", line)
+			}
+			return name, value, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", nil
+	}
+	readBlob := func(count string) ([]byte, error) {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PPK line count %q", count)
+		}
+		var encoded strings.Builder
+		for i := 0; i < n; i++ {
+			if !scanner.Scan() {
+				return nil, errors.New("PPK key is truncated")
+			}
+			encoded.WriteString(strings.TrimSpace(scanner.Text()))
+		}
+		return base64.StdEncoding.DecodeString(encoded.String())
+	}
+
+	for {
+		name, value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(name, ppkHeaderPrefix):
+			f.version, err = strconv.Atoi(strings.TrimPrefix(name, ppkHeaderPrefix))
+			if err != nil || (f.version != 2 && f.version != 3) {
+				return nil, fmt.Errorf("unsupported PPK format %q; only versions 2 and 3 are supported", name)
+			}
+			f.algorithm = value
+		case name == "Encryption":
+			f.encryption = value
+		case name == "Comment":
+			f.comment = value
+		case name == "Public-Lines":
+			if f.public, err = readBlob(value); err != nil {
+				return nil, fmt.Errorf("invalid PPK public key: %w", err)
+			}
+		case name == "Private-Lines":
+			if f.private, err = readBlob(value); err != nil {
+				return nil, fmt.Errorf("invalid PPK private key: %w", err)
+			}
+		case name == "Private-MAC":
+			if f.mac, err = hex.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("invalid PPK MAC: %w", err)
+			}
+		default:
+			f.headers[name] = value
+		}
+	}
+
+	if f.version == 0 {
+		return nil, errors.New("missing PPK header")
+	}
+	if f.public == nil || f.private == nil || f.mac == nil {
+		return nil, errors.New("PPK key is missing its public key, private key or MAC")
+	}
+	return f, nil
+}
+
+// ppkV2CipherKey derives the format 2 AES-256 key from two SHA-1 hashes of
+// the passphrase.
+func ppkV2CipherKey(passphrase []byte) []byte {
+	key := make([]byte, 0, 2*sha1.Size)
+	for i := uint32(0); i < 2; i++ {
+		h := sha1.New()
+		binary.Write(h, binary.BigEndian, i)
+		h.Write(passphrase)
+		key = h.Sum(key)
+	}
+	return key[:32]
+}
+
+// ppkV2MACKey derives the format 2 MAC key; unencrypted keys use an empty
+// passphrase.
+func ppkV2MACKey(passphrase []byte) []byte {
+	h := sha1.New()
+	h.Write([]byte("putty-private-key-file-mac-key"))
+	h.Write(passphrase)
+	return h.Sum(nil)
+}
+
+// ppkV3DeriveKeys runs the Argon2 key derivation named in the format 3
+// headers, returning 80 bytes: AES key, IV and MAC key.
+func ppkV3DeriveKeys(headers map[string]string, passphrase []byte) ([]byte, error) {
+	params := make(map[string]uint64)
+	for _, name := range []string{"Argon2-Memory", "Argon2-Passes", "Argon2-Parallelism"} {
+		v, err := strconv.ParseUint(headers[name], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PPK %s %q", name, headers[name])
+		}
+		params[name] = v
+	}
+	if params["Argon2-Parallelism"] == 0 || params["Argon2-Parallelism"] > 255 {
+		return nil, fmt.Errorf("unsupported PPK Argon2-Parallelism %d", params["Argon2-Parallelism"])
+	}
+	salt, err := hex.DecodeString(headers["Argon2-Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid PPK Argon2-Salt: %w", err)
+	}
+
+	memory := uint32(params["Argon2-Memory"])
+	passes := uint32(params["Argon2-Passes"])
+	threads := uint8(params["Argon2-Parallelism"])
+	switch headers["Key-Derivation"] {
+	case "Argon2id":
+		return argon2.IDKey(passphrase, salt, passes, memory, threads, 80), nil
+	case "Argon2i":
+		return argon2.Key(passphrase, salt, passes, memory, threads, 80), nil
+	default:
+		return nil, fmt.Errorf("unsupported PPK key derivation %q", headers["Key-Derivation"])
+	}
+}
+
+// ppkMAC computes the MAC over the algorithm, encryption, comment, public key
+// and decrypted private key, each as an SSH string.
+func ppkMAC(newHash func() hash.Hash, key []byte, f *ppkFile, private []byte) []byte {
+	mac := hmac.New(newHash, key)
+	for _, field := range [][]byte{[]byte(f.algorithm), []byte(f.encryption), []byte(f.comment), f.public, private} {
+		binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+	return mac.Sum(nil)
+}
+
+// ppkPrivateKey rebuilds the private key from the public blob, which carries
+// the public parameters, and the private blob, which carries the rest.
+func ppkPrivateKey(algorithm string, public []byte, private []byte) (interface{}, error) {
+	pub, err := ssh.ParsePublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PPK public key: %w", err)
+	}
+	if pub.Type() != algorithm {
+		return nil, fmt.Errorf("PPK header says %s but the public key is %s", algorithm, pub.Type())
+	}
+	cryptoPub := pub.(ssh.CryptoPublicKey).CryptoPublicKey()
+
+	r := sshReader(private)
+	switch pubKey := cryptoPub.(type) {
+	case *rsa.PublicKey:
+		d, p, q := r.mpint(), r.mpint(), r.mpint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		key := &rsa.PrivateKey{PublicKey: *pubKey, D: d, Primes: []*big.Int{p, q}}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid PPK RSA key: %w", err)
+		}
+		key.Precompute()
+		return key, nil
+	case *dsa.PublicKey:
+		x := r.mpint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &dsa.PrivateKey{PublicKey: *pubKey, X: x}, nil
+	case *ecdsa.PublicKey:
+		d := r.mpint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pubKey, D: d}, nil
+	case ed25519.PublicKey:
+		seed := r.string()
+		if r.err != nil {
+			return nil, r.err
+		}
+		// PuTTY writes the seed as a little-endian integer without its
+		// high zero bytes, so a short seed is padded back on the right
+		if len(seed) > ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid PPK Ed25519 key length %d", len(seed))
+		}
+		padded := make([]byte, ed25519.SeedSize)
+		copy(padded, seed)
+		defer wipeBytes(padded)
+		return ed25519.NewKeyFromSeed(padded), nil
+	default:
+		return nil, fmt.Errorf("unsupported PPK key type %s", algorithm)
+	}
+}
+
+// sshWireReader reads SSH wire-format strings and mpints, keeping the first
+// error.
+type sshWireReader struct {
+	data []byte
+	err  error
+}
+
+func sshReader(data []byte) *sshWireReader {
+	return &sshWireReader{data: data}
+}
+
+func (r *sshWireReader) string() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < 4 {
+		r.err = errors.New("PPK private key is truncated")
+		return nil
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	if uint64(n) > uint64(len(r.data)-4) {
+		r.err = errors.New("PPK private key is truncated")
+		return nil
+	}
+	s := r.data[4 : 4+n]
+	r.data = r.data[4+n:]
+	return s
+}
+
+func (r *sshWireReader) mpint() *big.Int {
+	return new(big.Int).SetBytes(r.string())
+}
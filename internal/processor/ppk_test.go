@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Fingerprints of the keys in testdata/ppk*.ppk. The -putty fixtures were
+// written by PuTTY and come from its test suite (cryptsuite.py,
+// testPPKLoadSave); the rest are written by testdata/ppkgen.
+const (
+	ppkPuTTYFingerprint     = "SHA256:Mv99xcHfjQuHbqmIs0Qx5I9kr7lX7Yw97eh4jZtoS70"
+	ppkRSAFingerprint       = "SHA256:k7wDweKLBjhtxW0DErwqSgh1THVokMo6chtGkOhle6o"
+	ppkECDSAFingerprint     = "SHA256:70O42qriq4DZ5DAtZL/xSjnYkFCwwiJainews1e6Ixw"
+	ppkEd25519Fingerprint   = "SHA256:1VCEhFagGXyFJaBntxZSTX2otwiG80o8WtKNQzGCBiQ"
+	ppkShortSeedFingerprint = "SHA256:A0SW7tAcD5pzupG4+JpBb/YOLGyUpb4WyCYiSwrP0Xs"
+	ppkPassphrase           = "correct horse"
+)
+
+func TestParsePPK(t *testing.T) {
+	fixtures := []struct {
+		file        string
+		encrypted   bool
+		fingerprint string
+	}{
+		{"ppk2-ed25519-putty.ppk", false, ppkPuTTYFingerprint},
+		{"ppk3-ed25519-putty.ppk", false, ppkPuTTYFingerprint},
+		{"ppk2-rsa-plain.ppk", false, ppkRSAFingerprint},
+		{"ppk2-rsa-encrypted.ppk", true, ppkRSAFingerprint},
+		{"ppk2-ecdsa-plain.ppk", false, ppkECDSAFingerprint},
+		{"ppk2-ecdsa-encrypted.ppk", true, ppkECDSAFingerprint},
+		{"ppk2-ed25519-plain.ppk", false, ppkEd25519Fingerprint},
+		{"ppk2-ed25519-encrypted.ppk", true, ppkEd25519Fingerprint},
+		{"ppk3-rsa-plain.ppk", false, ppkRSAFingerprint},
+		{"ppk3-rsa-encrypted.ppk", true, ppkRSAFingerprint},
+		{"ppk3-ecdsa-plain.ppk", false, ppkECDSAFingerprint},
+		{"ppk3-ecdsa-encrypted.ppk", true, ppkECDSAFingerprint},
+		{"ppk3-ed25519-plain.ppk", false, ppkEd25519Fingerprint},
+		{"ppk3-ed25519-encrypted.ppk", true, ppkEd25519Fingerprint},
+		{"ppk3-ed25519-short-seed.ppk", false, ppkShortSeedFingerprint},
+	}
+
+	for _, fx := range fixtures {
+		t.Run(fx.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", fx.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var passphrase []byte
+			if fx.encrypted {
+				passphrase = []byte(ppkPassphrase)
+			}
+			signer, err := parsePrivateKey(data, passphrase)
+			if err != nil {
+				t.Fatalf("parsePrivateKey: %v", err)
+			}
+			if got := ssh.FingerprintSHA256(signer.PublicKey()); got != fx.fingerprint {
+				t.Errorf("fingerprint = %s, want %s", got, fx.fingerprint)
+			}
+
+			message := []byte("strivescan")
+			sig, err := signer.Sign(rand.Reader, message)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if err := signer.PublicKey().Verify(message, sig); err != nil {
+				t.Errorf("signature does not verify: %v", err)
+			}
+
+			if !fx.encrypted {
+				return
+			}
+			if _, err := parsePPK(data, []byte("wrong horse")); err == nil || !strings.Contains(err.Error(), "passphrase does not decrypt") {
+				t.Errorf("wrong passphrase: got %v", err)
+			}
+			if _, err := parsePPK(data, nil); err == nil || !strings.Contains(err.Error(), "no passphrase is set") {
+				t.Errorf("missing passphrase: got %v", err)
+			}
+		})
+	}
+}
+
+// TestParsePPKChecksMAC edits the comment, which the MAC covers, so the
+// private key itself still parses.
+func TestParsePPKChecksMAC(t *testing.T) {
+	for _, file := range []string{"ppk2-ed25519-putty.ppk", "ppk3-ed25519-putty.ppk", "ppk2-rsa-plain.ppk"} {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tampered := bytes.Replace(data, []byte("Comment: "), []byte("Comment: x"), 1)
+			if _, err := parsePPK(tampered, nil); err == nil || !strings.Contains(err.Error(), "MAC does not match") {
+				t.Errorf("tampered comment: got %v", err)
+			}
+		})
+	}
+}
+
+func TestPPKPrivateKeyRejectsLongSeed(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ppk3-ed25519-plain.ppk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := readPPK(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private := append([]byte{0, 0, 0, 33}, make([]byte, 33)...)
+	if _, err := ppkPrivateKey(f.algorithm, f.public, private); err == nil || !strings.Contains(err.Error(), "key length 33") {
+		t.Errorf("33-byte seed: got %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package processor
 
 import (
 	"database/sql" // Placeholder for DB connection
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
 )
 
 // Config holds the parameters for data processing.
@@ -10,6 +12,32 @@ type Config struct {
 	TeamID int // 0 means not specified
 	Force  bool
 	Type   string // "scans" or "connections"
+
+	// Profile selects the export layout; empty or "standard" keeps each
+	// processor's own columns.
+	Profile string
+
+	// Run identifies this run in file names and delivery records, and records
+	// the files written for it.
+	Run *Run
+
+	// TeamSettings holds the per-team delivery settings keyed by team ID.
+	TeamSettings map[int64]models.SFTPSettings
+
+	// InvalidSettings holds the teams whose settings failed to parse, with
+	// the reason. Their files are not written.
+	InvalidSettings map[int64]error
+}
+
+// SettingsFor returns the delivery settings for a team, or the defaults if the
+// team has none.
+func (c Config) SettingsFor(teamID int64) models.SFTPSettings {
+	return c.TeamSettings[teamID]
+}
+
+// RunID returns the ID of the run, or "" if none was set.
+func (c Config) RunID() string {
+	return c.Run.idOrEmpty()
 }
 
 // DataProcessor defines the interface for processing different data types.
@@ -0,0 +1,224 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultOutputRoot is used when neither -output-dir nor OUTPUT_DIR is set.
+const DefaultOutputRoot = "output"
+
+// runsDirName is the directory under the output root holding one working
+// directory per run.
+const runsDirName = "runs"
+
+// runCompleteMarker is created in a run's directory once it has written all
+// of its files. Resends skip runs without it, which are still writing or
+// stopped part way.
+const runCompleteMarker = ".complete"
+
+// Run records what a single invocation wrote, so the delivery step can
+// describe each file in its manifest. Paths are tracked through compression
+// and encryption, which replace a file with a derived one.
+type Run struct {
+	ID   string
+	Root string // Output root shared by all runs
+
+	mu      sync.Mutex
+	files   map[string]RunFile
+	written map[int64][]string // Paths written per team, in write order
+}
+
+// RunFile describes the data held in one output file.
+type RunFile struct {
+	TeamID    int64
+	Rows      int
+	ScanTypes []string
+	Fairs     []string
+}
+
+// NewRun starts a run with a fresh ID under the given output root.
+func NewRun(root string) *Run {
+	if root == "" {
+		root = DefaultOutputRoot
+	}
+	return &Run{ID: NewRunID(), Root: root, files: make(map[string]RunFile), written: make(map[int64][]string)}
+}
+
+// Dir returns the run's working directory, <root>/runs/<id>. Without a run,
+// files go straight into the default output root.
+func (r *Run) Dir() string {
+	if r == nil {
+		return DefaultOutputRoot
+	}
+	return filepath.Join(r.Root, runsDirName, r.ID)
+}
+
+// TeamDir returns the directory the run writes a team's files to.
+func (r *Run) TeamDir(teamID int64) string {
+	return filepath.Join(r.Dir(), strconv.FormatInt(teamID, 10))
+}
+
+// RootDir returns the output root, or the default without a run.
+func (r *Run) RootDir() string {
+	if r == nil {
+		return DefaultOutputRoot
+	}
+	return r.Root
+}
+
+// MarkComplete records that the run has written all of its files, making
+// them available to a resend if their delivery fails. A run that wrote nothing
+// has no directory and is left as it is.
+func (r *Run) MarkComplete() error {
+	if r == nil {
+		return nil
+	}
+	if _, err := os.Stat(r.Dir()); os.IsNotExist(err) {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(r.Dir(), runCompleteMarker), nil, 0644)
+}
+
+// pendingTeamDirs returns every directory under root that may hold a team's
+// undelivered files: one per earlier run that finished writing, plus
+// <root>/<team> from before runs had their own directories.
+func pendingTeamDirs(root string, teamID int64) ([]string, error) {
+	team := strconv.FormatInt(teamID, 10)
+	matches, err := filepath.Glob(filepath.Join(root, runsDirName, "*", team))
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{filepath.Join(root, team)}
+	for _, dir := range matches {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), runCompleteMarker)); err != nil {
+			continue // Still being written, or stopped part way
+		}
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs[1:])
+	return dirs, nil
+}
+
+// removeEmptyDirs removes each directory in order if it is empty, ignoring
+// errors, so finished run directories don't accumulate. A run's completion
+// marker doesn't count as content.
+func removeEmptyDirs(dirs ...string) {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		if len(entries) == 1 && entries[0].Name() == runCompleteMarker {
+			os.Remove(filepath.Join(dir, runCompleteMarker))
+		} else if len(entries) > 0 {
+			return
+		}
+		os.Remove(dir)
+	}
+}
+
+// idOrEmpty returns the run ID, or "" for a nil run.
+func (r *Run) idOrEmpty() string {
+	if r == nil {
+		return ""
+	}
+	return r.ID
+}
+
+// recordFile registers a file written during the run.
+func (r *Run) recordFile(path string, file RunFile) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[path] = file
+	r.written[file.TeamID] = append(r.written[file.TeamID], path)
+}
+
+// TeamFiles returns the paths the run wrote for a team, in the order written.
+// Files derived from them later are not included.
+func (r *Run) TeamFiles(teamID int64) []string {
+	if r == nil {
+		return []string{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.written[teamID]...)
+}
+
+// File returns what the run recorded about path.
+func (r *Run) File(path string) (RunFile, bool) {
+	if r == nil {
+		return RunFile{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[path]
+	return file, ok
+}
+
+// derive records out as built from sources, combining their row counts, scan
+// types and fairs. Sources the run knows nothing about are ignored.
+func (r *Run) derive(sources []string, out string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var combined RunFile
+	found := false
+	for _, source := range sources {
+		file, ok := r.files[source]
+		if !ok {
+			continue
+		}
+		combined.TeamID = file.TeamID
+		combined.Rows += file.Rows
+		combined.ScanTypes = mergeSorted(combined.ScanTypes, file.ScanTypes)
+		combined.Fairs = mergeSorted(combined.Fairs, file.Fairs)
+		found = true
+	}
+	if found {
+		r.files[out] = combined
+	}
+}
+
+// mergeSorted returns the sorted union of two string lists.
+func mergeSorted(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	merged := []string{}
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				merged = append(merged, s)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// distinctFairs returns the sorted fair names found in header-first data.
+func distinctFairs(data [][]string) []string {
+	if len(data) == 0 {
+		return []string{}
+	}
+	fairCol := fairColumn(data[0])
+	if fairCol < 0 {
+		return []string{}
+	}
+	fairs := []string{}
+	for _, row := range data[1:] {
+		if fairCol < len(row) && cellText(row[fairCol]) != "" {
+			fairs = append(fairs, row[fairCol])
+		}
+	}
+	return mergeSorted(fairs, nil)
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+func TestCreatedTeamFilesUsesRunRecords(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// A relative output root, as with the default "output"
+	run := NewRun("output")
+	config := Config{Run: run, TeamSettings: map[int64]models.SFTPSettings{}}
+	groupedData := map[int64][][]string{
+		5: {{"Fair Name", "First Name"}, {"Boston", "Ada"}},
+		6: {{"Fair Name", "First Name"}, {"Denver", "Grace"}},
+	}
+	written, err := NewBaseProcessor(1).WriteTeamFiles(groupedData, config)
+	if err != nil {
+		t.Fatalf("WriteTeamFiles: %v", err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("wrote %v, want one file per team", written)
+	}
+
+	s := NewSFTPProcessor(nil, 0, nil, nil, run)
+	files := s.createdTeamFiles(5)
+	if len(files) != 1 || filepath.Base(files[0]) != filepath.Base(written[0]) {
+		t.Errorf("createdTeamFiles(5) = %v, want [%s]", files, written[0])
+	}
+	if files := s.createdTeamFiles(7); len(files) != 0 {
+		t.Errorf("createdTeamFiles(7) = %v, want none", files)
+	}
+}
+
+func TestPendingTeamDirsSkipsIncompleteRuns(t *testing.T) {
+	root := t.TempDir()
+	finished := &Run{ID: "20250101-090000-aaaaaa", Root: root}
+	writing := &Run{ID: "20250101-100000-bbbbbb", Root: root}
+	for _, run := range []*Run{finished, writing} {
+		if err := os.MkdirAll(run.TeamDir(5), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := finished.MarkComplete(); err != nil {
+		t.Fatalf("MarkComplete: %v", err)
+	}
+
+	dirs, err := pendingTeamDirs(root, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "5"), finished.TeamDir(5)}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("pendingTeamDirs = %v, want %v", dirs, want)
+	}
+
+	// Once its last team is delivered, the marker doesn't keep the run around
+	removeEmptyDirs(finished.TeamDir(5), finished.Dir())
+	if _, err := os.Stat(finished.Dir()); !os.IsNotExist(err) {
+		t.Errorf("%s was not removed: %v", finished.Dir(), err)
+	}
+
+	empty := &Run{ID: "20250101-110000-cccccc", Root: root}
+	if err := empty.MarkComplete(); err != nil {
+		t.Fatalf("MarkComplete for a run without files: %v", err)
+	}
+	if _, err := os.Stat(empty.Dir()); !os.IsNotExist(err) {
+		t.Errorf("MarkComplete created %s for a run that wrote nothing", empty.Dir())
+	}
+}
+
+func TestRemoveStaleDeliveryFiles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"scans.csv", "run-1" + manifestExtension, "run-1" + doneExtension, "scans.csv" + checksumExtension}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeStaleDeliveryFiles(dir, 5)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "scans.csv" {
+		t.Errorf("left %v, want only scans.csv", entries)
+	}
+}
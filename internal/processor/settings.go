@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/strivescan/strivescan-sftp/internal/logging"
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// Output formats accepted in the format setting
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatJSON  = "json"
+	FormatXLSX  = "xlsx"
+)
+
+// LoadTeamSettings reads the delivery settings for every team with SFTP
+// credentials, or only for teamID when it is non-zero. A team whose settings
+// are invalid is reported and returned in the second map rather than failing the
+// load, so the other teams are still exported.
+func LoadTeamSettings(db *sql.DB, teamID int) (map[int64]models.SFTPSettings, map[int64]error, error) {
+	var rows *sql.Rows
+	var err error
+	if teamID != 0 {
+		rows, err = db.Query("SELECT team_id, settings FROM sftp_credentials WHERE team_id = ?", teamID)
+	} else {
+		rows, err = db.Query("SELECT team_id, settings FROM sftp_credentials")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query team settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[int64]models.SFTPSettings)
+	invalid := make(map[int64]error)
+	for rows.Next() {
+		var id int64
+		var raw sql.NullString
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan team settings: %w", err)
+		}
+		teamSettings, err := parseSettings(raw)
+		if err != nil {
+			logging.Red("Invalid settings for team %d, skipping it: %v", id, err)
+			ProcessingErrors = append(ProcessingErrors, "Invalid settings for team "+strconv.FormatInt(id, 10)+": "+err.Error())
+			invalid[id] = err
+			continue
+		}
+		settings[id] = teamSettings
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating team settings: %w", err)
+	}
+
+	return settings, invalid, nil
+}
+
+// parseSettings decodes and validates a settings column value. NULL or empty
+// values yield the defaults.
+func parseSettings(raw sql.NullString) (models.SFTPSettings, error) {
+	var settings models.SFTPSettings
+	if !raw.Valid || raw.String == "" {
+		return settings, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw.String), &settings); err != nil {
+		return settings, fmt.Errorf("failed to parse settings JSON: %w", err)
+	}
+
+	switch settings.Format {
+	case "", FormatCSV, FormatJSONL, FormatJSON, FormatXLSX:
+	default:
+		return settings, fmt.Errorf("unknown output format %q", settings.Format)
+	}
+
+	if err := validateCSVDialect(settings.CSV); err != nil {
+		return settings, err
+	}
+
+	if settings.PGPSign && !settings.PGPEncrypt {
+		return settings, fmt.Errorf("pgp_sign requires pgp_encrypt")
+	}
+
+	if err := validateCompression(settings.Compression, settings.ZipEncrypt); err != nil {
+		return settings, err
+	}
+
+	switch settings.Verify {
+	case "", VerifySize, VerifyHash:
+	default:
+		return settings, fmt.Errorf("unknown verify mode %q", settings.Verify)
+	}
+
+	if settings.UploadRetries != nil && *settings.UploadRetries < 0 {
+		return settings, fmt.Errorf("upload_retries must not be negative")
+	}
+
+	if settings.SSHCertificate != "" && !isPlainFilename(settings.SSHCertificate) {
+		return settings, fmt.Errorf("ssh_certificate %q must be a plain file name inside %s", settings.SSHCertificate, sshKeyDirEnv)
+	}
+
+	if err := validateAuthOrder(settings.AuthOrder); err != nil {
+		return settings, err
+	}
+
+	if _, err := parseProxyJump(settings.ProxyJump); err != nil {
+		return settings, err
+	}
+	if settings.SOCKS5Proxy != "" {
+		proxy, err := parseSOCKS5Proxy(settings.SOCKS5Proxy)
+		if err != nil {
+			return settings, err
+		}
+		if !proxy.Username.Empty() {
+			return settings, fmt.Errorf("socks5_proxy must not include a username or password; store them as the team's socks5_username and socks5_password secrets")
+		}
+	}
+
+	if err := validateSSHOptions(settings); err != nil {
+		return settings, err
+	}
+
+	if settings.FilenameTemplate != "" {
+		if err := validateFilenameTemplate(settings.FilenameTemplate); err != nil {
+			return settings, err
+		}
+	}
+
+	return settings, nil
+}
@@ -1,25 +1,25 @@
 package processor
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/cristalhq/base64"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 
-	"github.com/fatih/color"
+	"github.com/strivescan/strivescan-sftp/internal/logging"
 	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
+	"github.com/strivescan/strivescan-sftp/internal/secrets"
 )
 
 // Global variable to store error messages
@@ -30,35 +30,79 @@ type SFTPProcessor struct {
 	BaseProcessor
 	db               *sql.DB
 	teamID           int
-	processedUFSIDs  []int64 // Track which UFS records were processed
-	processedFairIDs []int64 // Track which fair records were processed
+	processedUFSIDs  []int64                // Track which UFS records were processed
+	processedFairIDs []int64                // Track which fair records were processed
+	run              *Run                   // Describes the files written by this run; nothing else is uploaded
+	resend           bool                   // Upload files left by earlier runs instead of this run's
+	archiveDate      string                 // With resend, upload from this day's archive (YYYY-MM-DD)
+	outputRoot       string                 // With resend, the output root to search
+	secretProvider   secrets.SecretProvider // Supplies decrypted credentials; chosen by SECRET_PROVIDER when nil
 }
 
-func NewSFTPProcessor(db *sql.DB, teamID int, processedUFSIDs []int64, processedFairIDs []int64) *SFTPProcessor {
+func NewSFTPProcessor(db *sql.DB, teamID int, processedUFSIDs []int64, processedFairIDs []int64, run *Run) *SFTPProcessor {
 	return &SFTPProcessor{
 		db:               db,
 		teamID:           teamID,
 		processedUFSIDs:  processedUFSIDs,
 		processedFairIDs: processedFairIDs,
+		run:              run,
 	}
 }
 
+// NewResendProcessor returns a processor that uploads files written by earlier
+// runs under outputRoot: those a failed delivery left in a run directory, or,
+// when archiveDate is set, those archived as sent on that day.
+func NewResendProcessor(db *sql.DB, teamID int, outputRoot string, archiveDate string) *SFTPProcessor {
+	if outputRoot == "" {
+		outputRoot = DefaultOutputRoot
+	}
+	return &SFTPProcessor{
+		db:          db,
+		teamID:      teamID,
+		resend:      true,
+		archiveDate: archiveDate,
+		outputRoot:  outputRoot,
+	}
+}
+
+// root returns the output root the processor reads from and archives into.
+func (s *SFTPProcessor) root() string {
+	if s.resend {
+		return s.outputRoot
+	}
+	return s.run.RootDir()
+}
+
 func (s *SFTPProcessor) Process() error {
-	color.Magenta("Warming up SFTP processor...")
+	logging.Magenta("Warming up SFTP processor...")
+
+	if s.secretProvider == nil {
+		provider, err := secrets.FromEnv()
+		if err != nil {
+			ProcessingErrors = append(ProcessingErrors, "Failed to configure secret provider: "+err.Error())
+			logging.Red("Failed to configure secret provider: %v", err)
+			return fmt.Errorf("failed to configure secret provider: %w", err)
+		}
+		s.secretProvider = provider
+	}
+
 	// Get SFTP credentials from database
 	var query string
 	var rows *sql.Rows
 	var err error
+	query = `SELECT id, team_id, host, port, username, password, ssh_key, ssh_key_filename, passphrase,
+		upload_directory, notification_email, pgp_public_key, zip_password,
+		socks5_username, socks5_password, settings, created_at, updated_at
+		FROM sftp_credentials`
 	if s.teamID != 0 {
-		query = "SELECT * FROM sftp_credentials WHERE team_id = ?"
+		query += " WHERE team_id = ?"
 		rows, err = s.db.Query(query, s.teamID)
 	} else {
-		query = "SELECT * FROM sftp_credentials"
 		rows, err = s.db.Query(query)
 	}
 	if err != nil {
 		ProcessingErrors = append(ProcessingErrors, "Failed to query SFTP credentials: "+err.Error())
-		color.Red("Failed to query SFTP credentials: %v", err)
+		logging.Red("Failed to query SFTP credentials: %v", err)
 		return err
 	}
 	defer rows.Close()
@@ -78,21 +122,26 @@ func (s *SFTPProcessor) Process() error {
 			&creds.Passphrase,
 			&creds.UploadDirectory,
 			&creds.NotificationEmail,
+			&creds.PGPPublicKey,
+			&creds.ZipPassword,
+			&creds.SOCKS5Username,
+			&creds.SOCKS5Password,
+			&creds.Settings,
 			&creds.CreatedAt,
 			&creds.UpdatedAt,
 		)
 
 		if err != nil {
 			ProcessingErrors = append(ProcessingErrors, "Failed to scan SFTP credentials: "+err.Error())
-			color.Red("Failed to scan SFTP credentials: %v", err)
+			logging.Red("Failed to scan SFTP credentials: %v", err)
 			return err
 		}
 
-		fmt.Printf("Processing SFTP credentials for team %d on host %s\n", creds.TeamID, creds.Host)
+		logging.Printf("Processing SFTP credentials for team %d on host %s\n", creds.TeamID, creds.Host)
 		err = s.processCredentials(creds)
 		if err != nil {
 			ProcessingErrors = append(ProcessingErrors, "Failed to process credentials: "+err.Error())
-			color.Red("Failed to process credentials: %v", err)
+			logging.Red("Failed to process credentials: %v", err)
 			return err
 		}
 	}
@@ -101,330 +150,541 @@ func (s *SFTPProcessor) Process() error {
 }
 
 func (s *SFTPProcessor) processCredentials(creds models.SFTPCredentials) error {
-	// We need to make sure to decode the password, passphrase, and ssh_key
-	// If the password is encoded, we need to decode it
-	// If the passphrase is encoded, we need to decode it
-	// If the ssh_key is encoded, we need to decode it
-
-	// Decode the password
-	if creds.Password.Valid {
-		fmt.Printf("Attempting to decrypt password for team %d\n", creds.TeamID)
-		// For debugging, show a prefix of the encrypted password (first 20 chars max)
-		pwdPrefix := creds.Password.String
-		if len(pwdPrefix) > 20 {
-			pwdPrefix = pwdPrefix[:20] + "..."
-		}
-		fmt.Printf("Encrypted password prefix: %s\n", pwdPrefix)
-
-		decryptedPassword, err := s.decryptString(creds.Password.String)
-		if err != nil {
-			color.Red("Failed to decrypt password for team %d: %v", creds.TeamID, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to decrypt password for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
-			return fmt.Errorf("failed to decrypt password for team %d: %w", creds.TeamID, err)
-		}
+	// Errors logged from here on belong to this team's delivery
+	errStart := len(ProcessingErrors)
+	teamErrors := func() []string { return ProcessingErrors[errStart:] }
 
-		creds.Password = sql.NullString{
-			String: decryptedPassword,
-			Valid:  true,
-		}
+	teamSecrets, err := s.secretProvider.Secrets(context.Background(), creds)
+	if err != nil {
+		logging.Red("Failed to load secrets for team %d from %s: %v", creds.TeamID, s.secretProvider.Name(), err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to load secrets for team "+strconv.FormatInt(creds.TeamID, 10)+" from "+s.secretProvider.Name()+": "+err.Error())
+		return fmt.Errorf("failed to load secrets for team %d: %w", creds.TeamID, err)
 	}
+	defer teamSecrets.Wipe()
 
-	if creds.SSHKey.Valid {
-		fmt.Printf("Attempting to decrypt SSH Key for team %d\n", creds.TeamID)
-		// For debugging, show a prefix of the encrypted password (first 20 chars max)
-		pwdPrefix := creds.SSHKey.String
-		if len(pwdPrefix) > 20 {
-			pwdPrefix = pwdPrefix[:20] + "..."
-		}
-		fmt.Printf("Encrypted password prefix: %s\n", pwdPrefix)
+	// A team with invalid settings is skipped rather than stopping the
+	// other teams' deliveries
+	settings, err := parseSettings(creds.Settings)
+	if err != nil {
+		logging.Red("Invalid settings for team %d, skipping its delivery: %v", creds.TeamID, err)
+		ProcessingErrors = append(ProcessingErrors, "Invalid settings for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+		return nil
+	}
 
-		decryptedSSHKey, err := s.decryptString(creds.SSHKey.String)
-		if err != nil {
-			color.Red("Failed to decrypt SSH Key for team %d: %v", creds.TeamID, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to decrypt SSH Key for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
-			return fmt.Errorf("failed to decrypt password for team %d: %w", creds.TeamID, err)
-		}
+	files, err := s.teamOutputFiles(creds.TeamID)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		logging.Yellow("No files to upload for team %d", creds.TeamID)
+		return nil
+	}
 
-		creds.SSHKey = sql.NullString{
-			String: decryptedSSHKey,
-			Valid:  true,
-		}
+	// Reserve the sftp_updates row first so every later failure is recorded
+	// on it and the manifest can reference it
+	updateID, err := s.reserveUpdate(creds)
+	if err != nil {
+		return err
 	}
 
-	if creds.Passphrase.Valid {
-		fmt.Printf("Attempting to decrypt Passphrase for team %d\n", creds.TeamID)
-		// For debugging, show a prefix of the encrypted password (first 20 chars max)
-		pwdPrefix := creds.Passphrase.String
-		if len(pwdPrefix) > 20 {
-			pwdPrefix = pwdPrefix[:20] + "..."
-		}
-		fmt.Printf("Encrypted password prefix: %s\n", pwdPrefix)
+	files, err = s.prepareFiles(files, creds, teamSecrets, settings)
+	if err != nil {
+		logging.Red("Failed to prepare files for team %d: %v", creds.TeamID, err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to prepare files for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+		s.uploadFailure(creds, updateID, "Failed to prepare files", teamErrors())
+		return fmt.Errorf("failed to prepare files for team %d: %w", creds.TeamID, err)
+	}
 
-		decryptedPassphrase, err := s.decryptString(creds.Passphrase.String)
+	// An archived delivery is left as it was sent, so its bookkeeping files
+	// are written elsewhere and dropped afterwards
+	deliveryDir := ""
+	if s.archiveDate != "" {
+		deliveryDir, err = os.MkdirTemp("", "strivescan-delivery-")
 		if err != nil {
-			color.Red("Failed to decrypt passphrase for team %d: %v", creds.TeamID, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to decrypt passphrase for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
-			return fmt.Errorf("failed to decrypt password for team %d: %w", creds.TeamID, err)
+			logging.Red("Failed to create delivery directory for team %d: %v", creds.TeamID, err)
+			ProcessingErrors = append(ProcessingErrors, "Failed to create delivery directory for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+			s.uploadFailure(creds, updateID, "Failed to write delivery files", teamErrors())
+			return fmt.Errorf("failed to create delivery directory for team %d: %w", creds.TeamID, err)
 		}
+		defer os.RemoveAll(deliveryDir)
+	}
 
-		creds.Passphrase = sql.NullString{
-			String: decryptedPassphrase,
-			Valid:  true,
-		}
+	files, err = s.addDeliveryFiles(files, deliveryDir, creds, settings, updateID)
+	if err != nil {
+		logging.Red("Failed to write delivery files for team %d: %v", creds.TeamID, err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to write delivery files for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+		s.uploadFailure(creds, updateID, "Failed to write delivery files", teamErrors())
+		return fmt.Errorf("failed to write delivery files for team %d: %w", creds.TeamID, err)
 	}
 
-	client, err := s.ConnectToSFTP(creds)
+	// One session carries every transfer and retry for the team
+	session, err := s.ConnectToSFTP(creds, teamSecrets, settings)
 
 	if err != nil {
-		color.Red("Failed to connect to SFTP for team %d: %v", creds.TeamID, err)
+		logging.Red("Failed to connect to SFTP for team %d: %v", creds.TeamID, err)
 		ProcessingErrors = append(ProcessingErrors, "Failed to connect to SFTP for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+		s.uploadFailure(creds, updateID, "Failed to connect to SFTP", teamErrors())
 		return fmt.Errorf("failed to connect to SFTP for team %d: %w", creds.TeamID, err)
 	}
+	defer func() {
+		if err := session.Close(); err != nil {
+			logging.Yellow("Failed to close SFTP session for team %d: %v", creds.TeamID, err)
+		}
+	}()
 
-	err = s.uploadFiles(client, creds)
+	err = s.uploadFiles(session.Client, creds, settings, files, updateID)
 
+	// The delivery is recorded once, as a success only if every file made it
 	if err != nil {
-		color.Red("Failed to upload files for team %d: %v", creds.TeamID, err)
+		logging.Red("Failed to upload files for team %d: %v", creds.TeamID, err)
 		ProcessingErrors = append(ProcessingErrors, "Failed to upload files for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+		if _, recordErr := s.uploadFailure(creds, updateID, "Failed to upload files", teamErrors()); recordErr != nil {
+			logging.Red("Failed to record upload failure for team %d: %v", creds.TeamID, recordErr)
+		}
 		return fmt.Errorf("failed to upload files for team %d: %w", creds.TeamID, err)
 	}
 
+	if _, err := s.uploadSuccess(creds, updateID); err != nil {
+		return fmt.Errorf("failed to record upload success: %w", err)
+	}
+
+	// Sent files leave the output directory so later runs can't pick them up
+	if s.archiveDate == "" {
+		if _, err := archiveFiles(files, s.root(), creds.TeamID); err != nil {
+			logging.Red("Failed to archive files for team %d: %v", creds.TeamID, err)
+			ProcessingErrors = append(ProcessingErrors, "Failed to archive files for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+			return fmt.Errorf("failed to archive files for team %d: %w", creds.TeamID, err)
+		}
+		for _, path := range files {
+			teamDir := filepath.Dir(path)
+			if s.resend {
+				removeStaleDeliveryFiles(teamDir, creds.TeamID)
+			}
+			removeEmptyDirs(teamDir, filepath.Dir(teamDir))
+		}
+	}
+
 	return nil
 }
 
-func (s *SFTPProcessor) uploadFiles(client *sftp.Client, creds models.SFTPCredentials) error {
-	defer client.Close()
-	// Read the output directory for the team
-	files, err := os.ReadDir("output/" + strconv.FormatInt(creds.TeamID, 10))
-	if err != nil {
-		return fmt.Errorf("failed to read output directory for team %d: %w", creds.TeamID, err)
+// teamOutputFiles lists the files to upload for a team. A normal run only
+// takes the files it was given that belong to the team; files left by earlier
+// runs are picked up only by an explicit resend.
+func (s *SFTPProcessor) teamOutputFiles(teamID int64) ([]string, error) {
+	if !s.resend {
+		return s.createdTeamFiles(teamID), nil
 	}
 
-	// Upload each file to SFTP server
-	for _, file := range files {
-		if file.IsDir() {
-			continue // Skip directories
+	var teamDirs []string
+	switch {
+	case s.archiveDate != "":
+		date, err := time.Parse(archiveDateLayout, s.archiveDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive date %q: %w", s.archiveDate, err)
 		}
-
-		// Open local file
-		localPath := filepath.Join("output", strconv.FormatInt(creds.TeamID, 10), file.Name())
-		localFile, err := os.Open(localPath)
+		teamDirs = []string{archiveTeamDir(s.outputRoot, date, teamID)}
+	default:
+		dirs, err := pendingTeamDirs(s.outputRoot, teamID)
 		if err != nil {
-			color.Red("Failed to open local file %s: %v", localPath, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to open local file "+localPath+": "+err.Error())
-			return fmt.Errorf("failed to open local file %s: %w", localPath, err)
+			return nil, fmt.Errorf("failed to find pending files for team %d: %w", teamID, err)
 		}
+		teamDirs = dirs
+	}
 
-		creds.UploadDirectory = sql.NullString{
-			String: "upload",
-			Valid:  true,
+	files := []string{}
+	for _, teamDir := range teamDirs {
+		entries, err := os.ReadDir(teamDir)
+		if os.IsNotExist(err) {
+			continue
 		}
-
-		// Create remote file
-		remotePath := creds.UploadDirectory.String + "/" + file.Name() // Using root path since RemotePath is not defined in credentials
-		remoteFile, err := client.Create(remotePath)
 		if err != nil {
-			color.Red("Failed to create remote file %s: %v", remotePath, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to create remote file "+remotePath+": "+err.Error())
-			return fmt.Errorf("failed to create remote file %s: %w", remotePath, err)
+			return nil, fmt.Errorf("failed to read output directory for team %d: %w", teamID, err)
 		}
-		defer remoteFile.Close()
 
-		// Copy file contents
-		written, err := io.Copy(remoteFile, localFile)
-		if err != nil {
-			color.Red("Failed to copy file %s to remote: %v", localPath, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to copy file "+localPath+" to remote: "+err.Error())
-			return fmt.Errorf("failed to copy file %s to remote: %w", localPath, err)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue // Skip directories
+			}
+			if isDeliveryFile(entry.Name()) {
+				continue // Regenerated for every delivery
+			}
+			files = append(files, filepath.Join(teamDir, entry.Name()))
 		}
+	}
+	return files, nil
+}
 
-		color.Green("Successfully uploaded %s to %s (%d bytes)", localPath, remotePath, written)
+// createdTeamFiles returns the files this run wrote for a team, and warns
+// about anything else found in the team's directory, which is never uploaded.
+func (s *SFTPProcessor) createdTeamFiles(teamID int64) []string {
+	teamDir := s.run.TeamDir(teamID)
+	files := s.run.TeamFiles(teamID)
+	known := make(map[string]bool)
+	for _, path := range files {
+		known[filepath.Base(path)] = true
+	}
+
+	entries, err := os.ReadDir(teamDir)
+	if err != nil {
+		return files
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || known[entry.Name()] || isDeliveryFile(entry.Name()) {
+			continue
+		}
+		logging.Yellow("Warning: ignoring %s for team %d; it was not produced by this run", filepath.Join(teamDir, entry.Name()), teamID)
+	}
+	return files
+}
 
-		// Check if any processing errors occurred
-		if len(ProcessingErrors) > 0 {
-			color.Yellow("Warning: Processing errors occurred during upload:")
-			for _, errMsg := range ProcessingErrors {
-				color.Yellow("- %s", errMsg)
+// prepareFiles applies the team's pre-upload processing to its files and
+// returns the paths that should be uploaded. Files are compressed before they
+// are encrypted, since ciphertext does not compress.
+func (s *SFTPProcessor) prepareFiles(files []string, creds models.SFTPCredentials, teamSecrets *secrets.Credentials, settings models.SFTPSettings) ([]string, error) {
+	switch settings.Compression {
+	case CompressionGzip:
+		logging.Printf("Compressing %d files for team %d\n", len(files), creds.TeamID)
+		compressed, err := gzipFiles(files)
+		if err != nil {
+			return nil, err
+		}
+		for i, out := range compressed {
+			s.run.derive([]string{files[i]}, out)
+		}
+		files = compressed
+	case CompressionZip:
+		// Bundles left by a failed delivery are resent as they are
+		bundled, pending := []string{}, []string{}
+		for _, path := range files {
+			if isPrepared(path, ".zip") {
+				bundled = append(bundled, path)
+			} else {
+				pending = append(pending, path)
 			}
-			_, err := s.uploadFailure(creds)
-			if err != nil {
-				return fmt.Errorf("failed to record upload failure: %w", err)
+		}
+		if len(pending) == 0 {
+			break
+		}
+		var password redact.Secret
+		if settings.ZipEncrypt {
+			if teamSecrets.ZipPassword.Empty() {
+				return nil, errors.New("zip encryption is enabled but no zip_password is set")
 			}
+			password = teamSecrets.ZipPassword
+		}
+		logging.Printf("Bundling %d files for team %d\n", len(pending), creds.TeamID)
+		bundle, err := bundleFiles(pending, filepath.Dir(pending[0]), creds.TeamID, settings.FilenameTemplate, s.run.ID, password)
+		if err != nil {
+			return nil, err
+		}
+		s.run.derive(pending, bundle)
+		files = append(bundled, bundle)
+	}
 
-		} else {
-			_, err := s.uploadSuccess(creds)
-			if err != nil {
-				return fmt.Errorf("failed to record upload success: %w", err)
-			}
+	if settings.PGPEncrypt {
+		if !creds.PGPPublicKey.Valid || creds.PGPPublicKey.String == "" {
+			return nil, errors.New("PGP encryption is enabled but no pgp_public_key is set")
+		}
+		logging.Printf("Encrypting %d files for team %d\n", len(files), creds.TeamID)
+		encrypted, err := encryptFilesPGP(files, creds.PGPPublicKey.String, settings.PGPSign)
+		if err != nil {
+			return nil, err
+		}
+		for i, out := range encrypted {
+			s.run.derive([]string{files[i]}, out)
 		}
+		files = encrypted
 	}
 
-	return nil
+	return files, nil
 }
 
-func (s *SFTPProcessor) ConnectToSFTP(creds models.SFTPCredentials) (*sftp.Client, error) {
-	host := creds.Host
-	port := creds.Port
-	user := "foo"
-	password := "pass"
-	sshKey := ""
-	passphrase := ""
-
-	config := &ssh.ClientConfig{
-		User:            user,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+// addDeliveryFiles writes the manifest, the optional checksum sidecars and the
+// done file for a delivery into dir, or beside the exports when dir is empty.
+// It returns the upload order: each export followed by its sidecar, then the
+// manifest, then the done file last.
+func (s *SFTPProcessor) addDeliveryFiles(files []string, dir string, creds models.SFTPCredentials, settings models.SFTPSettings, updateID int64) ([]string, error) {
+	if len(files) == 0 {
+		return files, nil
 	}
+	if dir == "" {
+		dir = filepath.Dir(files[0])
+	}
+	baseName := deliveryBaseName(s.run)
 
-	// Check if SSH key is provided
-	if sshKey != "" {
-		var signer ssh.Signer
-		var err error
+	manifest, err := buildManifest(s.run, creds.TeamID, updateID, files)
+	if err != nil {
+		return nil, err
+	}
 
-		if passphrase != "" {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(sshKey), []byte(passphrase))
-		} else {
-			signer, err = ssh.ParsePrivateKey([]byte(sshKey))
+	delivery := make([]string, 0, 2*len(files)+2)
+	for i, path := range files {
+		delivery = append(delivery, path)
+		if settings.ChecksumSidecars {
+			sidecar, err := writeChecksumSidecar(path, manifest.Files[i].SHA256, dir)
+			if err != nil {
+				return nil, err
+			}
+			delivery = append(delivery, sidecar)
 		}
+	}
 
-		if err != nil {
-			color.Red("Failed to parse SSH key for team %d: %v", creds.TeamID, err)
-			ProcessingErrors = append(ProcessingErrors, "Failed to parse SSH key for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
-			return nil, fmt.Errorf("failed to parse SSH key: %w", err)
-		}
+	manifestPath, err := writeManifest(manifest, dir, baseName)
+	if err != nil {
+		return nil, err
+	}
+	donePath, err := writeDoneFile(dir, baseName)
+	if err != nil {
+		return nil, err
+	}
 
-		config.Auth = []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
+	return append(delivery, manifestPath, donePath), nil
+}
+
+// isDeliveryFile reports whether name is a manifest, checksum or done file
+// left by an earlier delivery.
+func isDeliveryFile(name string) bool {
+	return strings.HasSuffix(name, manifestExtension) ||
+		strings.HasSuffix(name, checksumExtension) ||
+		strings.HasSuffix(name, doneExtension)
+}
+
+// removeStaleDeliveryFiles deletes the manifest, checksum and done files that
+// failed deliveries left in dir. It is called once a resend of the files they
+// described has succeeded, so they describe nothing still pending.
+func removeStaleDeliveryFiles(dir string, teamID int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isDeliveryFile(entry.Name()) {
+			continue
 		}
-	} else if password != "" {
-		// Fall back to password auth if no SSH key
-		config.Auth = []ssh.AuthMethod{
-			ssh.Password(password),
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			logging.Yellow("Failed to remove stale delivery file %s for team %d: %v", filepath.Join(dir, entry.Name()), teamID, err)
 		}
-	} else {
-		color.Red("No authentication method provided - need either password or SSH key")
-		ProcessingErrors = append(ProcessingErrors, "No authentication method provided - need either password or SSH key")
-		return nil, fmt.Errorf("no authentication method provided - need either password or SSH key")
 	}
+}
 
-	addr := fmt.Sprintf("%s:%s", host, port)
+// uploadFile copies one local file to remotePath and returns the bytes
+// written. Both files are closed before it returns; a failed close of the
+// remote file fails the upload, since that is where many servers report write
+// errors.
+func (s *SFTPProcessor) uploadFile(client *sftp.Client, localPath string, remotePath string) (int64, error) {
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open local file %s: %w", localPath, err)
+	}
+	defer localFile.Close() // Read-only, nothing to lose on close
 
-	client, err := ssh.Dial("tcp", addr, config)
+	// Create remote file
+	remoteFile, err := client.Create(remotePath)
 	if err != nil {
-		color.Red("Failed to dial: %v", err)
-		ProcessingErrors = append(ProcessingErrors, "Failed to dial: "+err.Error())
-		return nil, fmt.Errorf("failed to dial: %w", err)
+		return 0, fmt.Errorf("failed to create remote file %s: %w", remotePath, err)
 	}
 
-	sftpClient, err := sftp.NewClient(client)
+	// Copy file contents
+	written, err := io.Copy(remoteFile, localFile)
 	if err != nil {
-		color.Red("Failed to create SFTP client: %v", err)
-		ProcessingErrors = append(ProcessingErrors, "Failed to create SFTP client: "+err.Error())
-		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
+		remoteFile.Close()
+		return written, fmt.Errorf("failed to copy file %s to remote: %w", localPath, err)
 	}
 
-	fmt.Println("SFTP client created successfully")
+	if err := remoteFile.Close(); err != nil {
+		return written, fmt.Errorf("failed to close remote file %s: %w", remotePath, err)
+	}
 
-	return sftpClient, nil
+	return written, nil
 }
 
-func (sp *SFTPProcessor) decryptString(encrypted string) (string, error) {
-	// Get the Laravel encryption key from environment
-	appKey := os.Getenv("LARAVEL_ENCRYPTION_KEY")
-	if appKey == "" {
-		return "", errors.New("LARAVEL_ENCRYPTION_KEY environment variable not set")
+// Statuses recorded per file in sftp_update_files
+const (
+	FileStatusSuccess = "success"
+	FileStatusFailure = "failure"
+	FileStatusSkipped = "skipped"
+)
+
+// uploadFiles uploads the delivery in order and records a child row for every
+// file. It stops at the first file that cannot be uploaded, so the done file
+// is never sent for an incomplete delivery; the files after it are recorded
+// as skipped.
+func (s *SFTPProcessor) uploadFiles(client *sftp.Client, creds models.SFTPCredentials, settings models.SFTPSettings, files []string, updateID int64) error {
+	attempts := uploadAttempts(settings)
+
+	creds.UploadDirectory = sql.NullString{
+		String: "upload",
+		Valid:  true,
 	}
 
-	// First try to parse as JSON directly
-	var jsonData map[string]interface{}
-	err := json.Unmarshal([]byte(encrypted), &jsonData)
-	if err != nil {
-		// If not valid JSON, try to repair base64
-		fmt.Println("Not valid JSON, attempting base64 repair")
-		// Remove any whitespace and newlines
-		encrypted = strings.TrimSpace(encrypted)
-		// Add padding if needed
-		if len(encrypted)%4 != 0 {
-			encrypted += strings.Repeat("=", 4-len(encrypted)%4)
-		}
+	outcomes := make([]models.SFTPUpdateFile, 0, len(files))
+	var uploadErr error
 
-		// Try base64 decode again
-		decoded, err := base64.StdEncoding.DecodeString(encrypted)
-		if err != nil {
-			fmt.Printf("Base64 decode error after repair: %v\n", err)
-			return "", fmt.Errorf("failed to decode base64: %w", err)
+	// Upload each file to SFTP server
+	for _, localPath := range files {
+		outcome := models.SFTPUpdateFile{
+			SFTPUpdateID: updateID,
+			Name:         filepath.Base(localPath),
+			Status:       FileStatusSkipped,
+		}
+		if uploadErr != nil {
+			outcomes = append(outcomes, outcome)
+			continue
 		}
 
-		// Try to parse the decoded data as JSON
-		err = json.Unmarshal(decoded, &jsonData)
+		remotePath := creds.UploadDirectory.String + "/" + filepath.Base(localPath) // Using root path since RemotePath is not defined in credentials
+
+		sum, size, err := fileSHA256(localPath)
+		if err == nil {
+			outcome.SHA256 = sum
+			outcome.Size = size
+			for attempt := 1; attempt <= attempts; attempt++ {
+				_, err = s.uploadFile(client, localPath, remotePath)
+				if err == nil {
+					err = verifyUpload(client, localPath, remotePath, settings.Verify)
+				}
+				if err == nil {
+					break
+				}
+				logging.Yellow("Upload attempt %d/%d of %s failed: %v", attempt, attempts, localPath, err)
+				if attempt < attempts {
+					time.Sleep(time.Duration(attempt) * uploadRetryDelay)
+				}
+			}
+		}
 		if err != nil {
-			fmt.Printf("JSON unmarshal error after base64 decode: %v\n", err)
-			return "", fmt.Errorf("failed to unmarshal JSON: %w", err)
+			logging.Red("Failed to upload %s to %s: %v", localPath, remotePath, err)
+			ProcessingErrors = append(ProcessingErrors, "Failed to upload "+localPath+" to "+remotePath+": "+err.Error())
+			outcome.Status = FileStatusFailure
+			outcome.Error = err.Error()
+			uploadErr = fmt.Errorf("failed to upload %s to %s: %w", localPath, remotePath, err)
+		} else {
+			logging.Green("Successfully uploaded %s to %s (%d bytes)", localPath, remotePath, size)
+			outcome.Status = FileStatusSuccess
 		}
+		outcomes = append(outcomes, outcome)
 	}
 
-	// Verify we have the required fields
-	if jsonData["iv"] == nil || jsonData["value"] == nil {
-		return "", errors.New("missing required fields in JSON")
+	if err := s.recordUpdateFiles(outcomes); err != nil {
+		return err
 	}
 
-	return sp.decryptFromJSON(jsonData, appKey)
+	return uploadErr
+}
+
+// SFTPSession is an SFTP client together with the SSH connection it runs over.
+type SFTPSession struct {
+	SSH    *ssh.Client
+	Client *sftp.Client
+	Hops   []*ssh.Client // Jump host connections, in dial order
 }
 
-func (sp *SFTPProcessor) decryptFromJSON(jsonData map[string]interface{}, appKey string) (string, error) {
-	// Extract IV and ciphertext
-	ivStr, ok := jsonData["iv"].(string)
-	if !ok {
-		return "", errors.New("invalid IV format in JSON")
+// Close shuts down the SFTP client and then the connections beneath it,
+// returning the first error.
+func (ss *SFTPSession) Close() error {
+	sftpErr := ss.Client.Close()
+	sshErr := ss.closeSSH()
+	if sftpErr != nil {
+		return fmt.Errorf("failed to close SFTP client: %w", sftpErr)
 	}
+	return sshErr
+}
 
-	valueStr, ok := jsonData["value"].(string)
-	if !ok {
-		return "", errors.New("invalid value format in JSON")
+// closeSSH closes the SSH connection and then any jump hosts, from the last
+// hop back.
+func (ss *SFTPSession) closeSSH() error {
+	sshErr := ss.SSH.Close()
+	var hopErr error
+	for i := len(ss.Hops) - 1; i >= 0; i-- {
+		if err := ss.Hops[i].Close(); err != nil && !errors.Is(err, net.ErrClosed) && hopErr == nil {
+			hopErr = err
+		}
+	}
+	if sshErr != nil && !errors.Is(sshErr, net.ErrClosed) {
+		return fmt.Errorf("failed to close SSH connection: %w", sshErr)
 	}
+	if hopErr != nil {
+		return fmt.Errorf("failed to close jump host connection: %w", hopErr)
+	}
+	return nil
+}
 
-	// Decode the IV and ciphertext
-	iv, err := base64.StdEncoding.DecodeString(ivStr)
+func (s *SFTPProcessor) ConnectToSFTP(creds models.SFTPCredentials, teamSecrets *secrets.Credentials, settings models.SFTPSettings) (*SFTPSession, error) {
+	host := creds.Host
+	port := creds.Port
+
+	hostKeys, err := hostKeyCallback(settings)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode IV: %w", err)
+		logging.Red("Failed to load known hosts: %v", err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to load known hosts: "+err.Error())
+		return nil, err
 	}
 
-	ciphertext, err := base64.StdEncoding.DecodeString(valueStr)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	config := &ssh.ClientConfig{
+		User:            creds.Username,
+		HostKeyCallback: hostKeys,
 	}
+	applyAlgorithms(config, settings)
 
-	// Remove the "base64:" prefix if present
-	if len(appKey) > 7 && appKey[:7] == "base64:" {
-		appKey = appKey[7:]
+	// Each connection, the server's and every jump host's, gets its own auth
+	// methods; agent connections are closed once the handshakes are done
+	agentConns := []net.Conn{}
+	defer func() {
+		for _, conn := range agentConns {
+			conn.Close()
+		}
+	}()
+	newAuth := func() ([]ssh.AuthMethod, error) {
+		auth, agentConn, err := authMethods(creds, teamSecrets, settings)
+		if err != nil {
+			return nil, err
+		}
+		if agentConn != nil {
+			agentConns = append(agentConns, agentConn)
+		}
+		return auth, nil
 	}
 
-	// Decode the base64 encoded key
-	key, err := base64.StdEncoding.DecodeString(appKey)
+	auth, err := newAuth()
 	if err != nil {
-		return "", fmt.Errorf("error decoding key: %w", err)
+		logging.Red("Failed to set up authentication for team %d: %v", creds.TeamID, err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to set up authentication for team "+strconv.FormatInt(creds.TeamID, 10)+": "+err.Error())
+		return nil, err
+	}
+	if len(auth) == 0 {
+		logging.Red("No authentication method provided - need either password or SSH key")
+		ProcessingErrors = append(ProcessingErrors, "No authentication method provided - need either password or SSH key")
+		return nil, fmt.Errorf("no authentication method provided - need either password or SSH key")
 	}
+	config.Auth = auth
+
+	addr := fmt.Sprintf("%s:%s", host, port)
 
-	// Create the AES cipher
-	block, err := aes.NewCipher(key)
+	client, hops, err := dialSSH(addr, config, settings, teamSecrets, newAuth)
 	if err != nil {
-		return "", fmt.Errorf("failed to create AES cipher: %w", err)
+		logging.Red("Failed to dial: %v", err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to dial: "+err.Error())
+		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
 
-	// Create the decrypter
-	mode := cipher.NewCBCDecrypter(block, iv)
-	plaintext := make([]byte, len(ciphertext))
-	mode.CryptBlocks(plaintext, ciphertext)
-
-	// Remove PKCS#7 padding
-	plaintext, err = removePadding(plaintext)
+	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
-		return "", err
+		(&SFTPSession{SSH: client, Hops: hops}).closeSSH()
+		logging.Red("Failed to create SFTP client: %v", err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to create SFTP client: "+err.Error())
+		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
 	}
 
-	return string(plaintext), nil
+	logging.Println("SFTP client created successfully")
+
+	return &SFTPSession{SSH: client, Client: sftpClient, Hops: hops}, nil
 }
 
-func (sp *SFTPProcessor) uploadSuccess(creds models.SFTPCredentials) (string, error) {
+// reserveUpdate inserts the sftp_updates row for a delivery with status
+// "processing" and returns its ID. uploadSuccess and uploadFailure later set
+// the final status on the same row.
+func (sp *SFTPProcessor) reserveUpdate(creds models.SFTPCredentials) (int64, error) {
 	insertQuery := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
 		"sftp_updates",
 		"id",
@@ -437,17 +697,16 @@ func (sp *SFTPProcessor) uploadSuccess(creds models.SFTPCredentials) (string, er
 		"type")
 
 	stmt, err := sp.db.Prepare(insertQuery)
-	fmt.Println(insertQuery, stmt, err)
 	if err != nil {
-		color.Red("Failed to prepare insert statement: %v", err)
+		logging.Red("Failed to prepare insert statement: %v", err)
 		ProcessingErrors = append(ProcessingErrors, "Failed to prepare insert statement: "+err.Error())
-		return "", fmt.Errorf("failed to prepare insert statement: %w", err)
+		return 0, fmt.Errorf("failed to prepare insert statement: %w", err)
 	}
 	defer stmt.Close()
 
 	insertExec, err := stmt.Exec(
 		nil,
-		"success",
+		"processing",
 		creds.TeamID,
 		"",
 		"",
@@ -457,16 +716,45 @@ func (sp *SFTPProcessor) uploadSuccess(creds models.SFTPCredentials) (string, er
 	)
 
 	if err != nil {
-		color.Red("Failed to execute insert statement: %v", err)
+		logging.Red("Failed to execute insert statement: %v", err)
 		ProcessingErrors = append(ProcessingErrors, "Failed to execute insert statement: "+err.Error())
-		return "", fmt.Errorf("failed to execute insert statement: %w", err)
+		return 0, fmt.Errorf("failed to execute insert statement: %w", err)
 	}
 
 	id, err := insertExec.LastInsertId()
 	if err != nil {
-		color.Red("Failed to get last insert ID: %v", err)
+		logging.Red("Failed to get last insert ID: %v", err)
 		ProcessingErrors = append(ProcessingErrors, "Failed to get last insert ID: "+err.Error())
-		return "", fmt.Errorf("failed to get last insert ID: %w", err)
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// finishUpdate sets the final status of a reserved sftp_updates row.
+func (sp *SFTPProcessor) finishUpdate(updateID int64, status string, errorText string, errorDescription string) error {
+	updateQuery := "UPDATE sftp_updates SET status = ?, error = ?, error_description = ?, updated_at = ? WHERE id = ?"
+
+	_, err := sp.db.Exec(
+		updateQuery,
+		status,
+		errorText,
+		errorDescription,
+		time.Now().Format("2006-01-02 15:04:05"),
+		updateID,
+	)
+	if err != nil {
+		logging.Red("Failed to execute update statement: %v", err)
+		ProcessingErrors = append(ProcessingErrors, "Failed to execute update statement: "+err.Error())
+		return fmt.Errorf("failed to execute update statement: %w", err)
+	}
+
+	return nil
+}
+
+func (sp *SFTPProcessor) uploadSuccess(creds models.SFTPCredentials, updateID int64) (string, error) {
+	if err := sp.finishUpdate(updateID, "success", "", ""); err != nil {
+		return "", err
 	}
 
 	// Update processed UFS and Fair IDs together since they correspond to the same records
@@ -475,58 +763,56 @@ func (sp *SFTPProcessor) uploadSuccess(creds models.SFTPCredentials) (string, er
 		fairID := sp.processedFairIDs[i]
 
 		// Update UFS record
-		sp.updateUserFairStudents(studentID, fairID, id, creds.TeamID)
+		sp.updateUserFairStudents(studentID, fairID, updateID, creds.TeamID)
 	}
 
-	return strconv.FormatInt(id, 10), nil
+	return strconv.FormatInt(updateID, 10), nil
 }
 
-func (sp *SFTPProcessor) uploadFailure(creds models.SFTPCredentials) (string, error) {
-	insertQuery := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		"sftp_updates",
-		"id",
-		"status",
-		"team_id",
-		"error",
-		"error_description",
-		"created_at",
-		"updated_at",
-		"type")
+// recordUpdateFiles inserts one sftp_update_files row per file of a delivery.
+func (sp *SFTPProcessor) recordUpdateFiles(files []models.SFTPUpdateFile) error {
+	insertQuery := `INSERT INTO sftp_update_files
+		(sftp_update_id, name, size, sha256, status, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
 	stmt, err := sp.db.Prepare(insertQuery)
-	fmt.Println(insertQuery, stmt, err)
 	if err != nil {
-		color.Red("Failed to prepare insert statement: %v", err)
+		logging.Red("Failed to prepare insert statement: %v", err)
 		ProcessingErrors = append(ProcessingErrors, "Failed to prepare insert statement: "+err.Error())
-		return "", fmt.Errorf("failed to prepare insert statement: %w", err)
+		return fmt.Errorf("failed to prepare insert statement: %w", err)
 	}
 	defer stmt.Close()
 
-	insertExec, err := stmt.Exec(
-		nil,
-		"failure",
-		creds.TeamID,
-		"Failed to upload files",
-		strings.Join(ProcessingErrors, ", "),
-		time.Now().Format("2006-01-02 15:04:05"),
-		time.Now().Format("2006-01-02 15:04:05"),
-		"SFTPUPLOAD",
-	)
-
-	if err != nil {
-		color.Red("Failed to execute insert statement: %v", err)
-		ProcessingErrors = append(ProcessingErrors, "Failed to execute insert statement: "+err.Error())
-		return "", fmt.Errorf("failed to execute insert statement: %w", err)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, file := range files {
+		_, err := stmt.Exec(
+			file.SFTPUpdateID,
+			file.Name,
+			file.Size,
+			file.SHA256,
+			file.Status,
+			file.Error,
+			now,
+			now,
+		)
+		if err != nil {
+			logging.Red("Failed to record file %s: %v", file.Name, err)
+			ProcessingErrors = append(ProcessingErrors, "Failed to record file "+file.Name+": "+err.Error())
+			return fmt.Errorf("failed to record file %s: %w", file.Name, err)
+		}
 	}
 
-	id, err := insertExec.LastInsertId()
-	if err != nil {
-		color.Red("Failed to get last insert ID: %v", err)
-		ProcessingErrors = append(ProcessingErrors, "Failed to get last insert ID: "+err.Error())
-		return "", fmt.Errorf("failed to get last insert ID: %w", err)
+	return nil
+}
+
+// uploadFailure marks a delivery as failed, describing it with the errors
+// logged for the team's delivery only.
+func (sp *SFTPProcessor) uploadFailure(creds models.SFTPCredentials, updateID int64, errorText string, teamErrors []string) (string, error) {
+	if err := sp.finishUpdate(updateID, "failure", errorText, strings.Join(teamErrors, ", ")); err != nil {
+		return "", err
 	}
 
-	return strconv.FormatInt(id, 10), nil
+	return strconv.FormatInt(updateID, 10), nil
 }
 
 func (s *SFTPProcessor) updateUserFairStudents(studentID int64, fairID int64, sftpUpdateID int64, teamID int64) error {
@@ -539,7 +825,7 @@ func (s *SFTPProcessor) updateUserFairStudents(studentID int64, fairID int64, sf
 	// _, err := s.db.Exec(updateQuery)
 
 	// if err != nil {
-	// 	color.Red("Failed to update user_fair_students: %v", err)
+	// 	logging.Red("Failed to update user_fair_students: %v", err)
 	// 	ProcessingErrors = append(ProcessingErrors, "Failed to update user_fair_students: "+err.Error())
 	// 	return fmt.Errorf("failed to update user_fair_students: %w", err)
 	// }
@@ -553,23 +839,3 @@ func min(a, b int) int {
 	}
 	return b
 }
-
-// removePadding removes PKCS#7 padding
-func removePadding(data []byte) ([]byte, error) {
-	if len(data) == 0 {
-		return nil, errors.New("empty data")
-	}
-
-	padding := int(data[len(data)-1])
-	if padding > len(data) {
-		return nil, errors.New("invalid padding")
-	}
-
-	for i := len(data) - padding; i < len(data); i++ {
-		if int(data[i]) != padding {
-			return nil, errors.New("invalid padding")
-		}
-	}
-
-	return data[:len(data)-padding], nil
-}
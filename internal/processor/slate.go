@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// Slate value formats
+const (
+	slateText     = "text"
+	slateDate     = "date"
+	slateDateTime = "datetime"
+	slateYesNo    = "yn"
+	slateKey      = "key"
+)
+
+// Layouts used when writing Slate date values
+const (
+	slateDateLayout     = "01/02/2006"
+	slateDateTimeLayout = "01/02/2006 15:04"
+)
+
+// Where a Slate field's sources are looked up
+const (
+	fromStandard = "standard" // Standard export headers, e.g. "First Name"
+	fromFull     = "full"     // Full profile fields, e.g. "student_id"
+)
+
+// slateField defines one column of the Slate source format. SourceKind says
+// whether Sources name standard export headers or full profile fields, and the
+// same definition drives both the export and the mapping document.
+type slateField struct {
+	Header      string
+	SourceKind  string
+	Sources     []string
+	Format      string
+	Description string
+}
+
+// slateFields is the fixed Slate header dictionary, in output order.
+var slateFields = []slateField{
+	{"Ref", fromFull, []string{"student_id", "fair_id"}, slateKey, "Unique key for the person at this event"},
+	{"First", fromStandard, []string{"First Name"}, slateText, ""},
+	{"Last", fromStandard, []string{"Last Name"}, slateText, ""},
+	{"Email", fromStandard, []string{"Email"}, slateText, ""},
+	{"Phone", fromStandard, []string{"Phone"}, slateText, ""},
+	{"SMS Opt-In", fromStandard, []string{"Text Permission"}, slateYesNo, ""},
+	{"Street 1", fromStandard, []string{"Address 1"}, slateText, ""},
+	{"Street 2", fromStandard, []string{"Address 2"}, slateText, ""},
+	{"City", fromStandard, []string{"Address City"}, slateText, ""},
+	{"Region", fromStandard, []string{"Address State"}, slateText, ""},
+	{"Postal", fromStandard, []string{"Address ZIP"}, slateText, ""},
+	{"Country", fromFull, []string{"address_country_code"}, slateText, "ISO 3166-1 alpha-2 code"},
+	{"Birthdate", fromStandard, []string{"Birthdate"}, slateDate, "Passed through unchanged if it cannot be parsed"},
+	{"School", fromStandard, []string{"High School"}, slateText, ""},
+	{"School City", fromStandard, []string{"High School City"}, slateText, ""},
+	{"School Region", fromStandard, []string{"High School State"}, slateText, ""},
+	{"School CEEB", fromStandard, []string{"CEEB Code"}, slateText, ""},
+	{"Graduation Year", fromStandard, []string{"Graduation Year"}, slateText, ""},
+	{"Entry Term", fromStandard, []string{"College Start"}, slateText, ""},
+	{"GPA", fromStandard, []string{"GPA"}, slateText, ""},
+	{"GPA Scale", fromStandard, []string{"GPA Max"}, slateText, ""},
+	{"SAT Total", fromStandard, []string{"SAT"}, slateText, ""},
+	{"ACT Composite", fromStandard, []string{"ACT"}, slateText, ""},
+	{"Academic Interest 1", fromStandard, []string{"Area of Interest 1"}, slateText, ""},
+	{"Academic Interest 2", fromStandard, []string{"Area of Interest 2"}, slateText, ""},
+	{"Academic Interest 3", fromStandard, []string{"Area of Interest 3"}, slateText, ""},
+	{"Hispanic Cuban", fromStandard, []string{"Ethnicity Cuban"}, slateYesNo, ""},
+	{"Hispanic Mexican", fromStandard, []string{"Ethnicity Mexican"}, slateYesNo, ""},
+	{"Hispanic Puerto Rican", fromStandard, []string{"Ethnicity Puerto Rican"}, slateYesNo, ""},
+	{"Hispanic Other", fromStandard, []string{"Ethnicity Other Hispanic, Latino, or Spanish"}, slateYesNo, ""},
+	{"Not Hispanic", fromStandard, []string{"Ethnicity Non-Hispanic, Latino, or Spanish"}, slateYesNo, ""},
+	{"Race American Indian or Alaska Native", fromStandard, []string{"Race American Indian or Alaskan Native"}, slateYesNo, ""},
+	{"Race Asian", fromStandard, []string{"Race Asian"}, slateYesNo, ""},
+	{"Race Black or African American", fromStandard, []string{"Race Black or African American"}, slateYesNo, ""},
+	{"Race Native Hawaiian or Other Pacific Islander", fromStandard, []string{"Race Native Hawaiian or Other Pacific Islander"}, slateYesNo, ""},
+	{"Race White", fromStandard, []string{"Race White"}, slateYesNo, ""},
+	{"Rating", fromStandard, []string{"Rating"}, slateText, ""},
+	{"Notes", fromStandard, []string{"Notes"}, slateText, ""},
+	{"Follow Up", fromStandard, []string{"Follow Up"}, slateYesNo, ""},
+	{"Person Type", fromStandard, []string{"Parent or Student"}, slateText, "Parent or Student"},
+	{"Event", fromStandard, []string{"Fair Name"}, slateText, ""},
+	{"Event ID", fromStandard, []string{"Internal Event ID"}, slateText, ""},
+	{"Event Date", fromFull, []string{"fair_date"}, slateDate, ""},
+	{"Scan Date", fromStandard, []string{"Scan Time"}, slateDateTime, ""},
+	{"Scan Rep", fromStandard, []string{"Scan Rep"}, slateText, ""},
+	{"Language", fromStandard, []string{"Registration Language"}, slateText, ""},
+	{"Event Guide Favorite", fromStandard, []string{"Event Guide"}, slateYesNo, ""},
+	{"Updated Date", fromStandard, []string{"Updated Time"}, slateDateTime, ""},
+}
+
+// SlateExportProfile returns the profile producing Slate source format rows,
+// one per student per fair.
+func SlateExportProfile() *ExportProfile {
+	columns := make([]ExportColumn, len(slateFields))
+	for i, field := range slateFields {
+		columns[i] = ExportColumn{Header: field.Header, Value: field.value}
+	}
+	return &ExportProfile{
+		Name:    ProfileSlate,
+		Columns: columns,
+		Key: func(scan models.StudentScanData) string {
+			return fmt.Sprintf("%d-%d", scan.StudentID, scan.FairID)
+		},
+	}
+}
+
+// value resolves the field's sources from the record and applies its format.
+func (f slateField) value(r *exportRecord) string {
+	values := make([]string, len(f.Sources))
+	for i, source := range f.Sources {
+		if f.SourceKind == fromFull {
+			values[i] = r.Field(source)
+		} else {
+			values[i] = r.Standard(source)
+		}
+		// Plain text fields pass NULL through; formatted ones read it as empty
+		if f.Format != slateText {
+			values[i] = cellText(values[i])
+		}
+	}
+
+	switch f.Format {
+	case slateKey:
+		return strings.Join(values, "-")
+	case slateDate:
+		return formatSlateTime(values[0], slateDateLayout)
+	case slateDateTime:
+		return formatSlateTime(values[0], slateDateTimeLayout)
+	case slateYesNo:
+		return formatSlateYesNo(values[0])
+	default:
+		return values[0]
+	}
+}
+
+// formatSlateTime rewrites a date or timestamp into layout. Values that cannot
+// be parsed are returned unchanged so no data is lost.
+func formatSlateTime(value string, layout string) string {
+	if value == "" {
+		return ""
+	}
+	for _, in := range []string{"2006-01-02 15:04:05", "2006-01-02", "01/02/2006", "1/2/2006"} {
+		if t, err := time.Parse(in, value); err == nil {
+			return t.Format(layout)
+		}
+	}
+	return value
+}
+
+// formatSlateYesNo collapses the various truthy and falsy values used across
+// the standard export into Y or N.
+func formatSlateYesNo(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "n", "no", "false", "0":
+		return "N"
+	default:
+		return "Y"
+	}
+}
+
+// WriteSlateMapping writes the Slate source format mapping document to path as CSV.
+func WriteSlateMapping(path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory '%s': %w", dir, err)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create Slate mapping file '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	records := [][]string{{"Slate Field", "StriveScan Source", "Source Layout", "Format", "Notes"}}
+	for _, field := range slateFields {
+		layout := "Standard export"
+		if field.SourceKind == fromFull {
+			layout = "Full profile"
+		}
+		records = append(records, []string{
+			field.Header,
+			strings.Join(field.Sources, " + "),
+			layout,
+			slateFormatDescription(field.Format),
+			field.Description,
+		})
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write Slate mapping to '%s': %w", path, err)
+	}
+
+	return file.Close()
+}
+
+// slateFormatDescription returns the human-readable description of a Slate format.
+func slateFormatDescription(format string) string {
+	switch format {
+	case slateKey:
+		return "Text, values joined with '-'"
+	case slateDate:
+		return "Date (MM/DD/YYYY)"
+	case slateDateTime:
+		return "Date/Time (MM/DD/YYYY HH:MM)"
+	case slateYesNo:
+		return "Y/N"
+	default:
+		return "Text"
+	}
+}
@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+func TestSlateSourcesExist(t *testing.T) {
+	standard := profileFormatter.GetCSVHeader()
+	full := FullExportProfile().Header()
+	for _, field := range slateFields {
+		header := standard
+		if field.SourceKind == fromFull {
+			header = full
+		} else if field.SourceKind != fromStandard {
+			t.Errorf("%s has unknown source kind %q", field.Header, field.SourceKind)
+			continue
+		}
+		for _, source := range field.Sources {
+			if !slices.Contains(header, source) {
+				t.Errorf("%s: source %q is not a %s column", field.Header, source, field.SourceKind)
+			}
+		}
+	}
+}
+
+// slateRow returns the Slate values of scan keyed by header.
+func slateRow(scan models.StudentScanData) map[string]string {
+	profile := SlateExportProfile()
+	return zipRow(profile.Header(), profile.TransformScanToRow(scan))
+}
+
+func TestSlateFormats(t *testing.T) {
+	scan := models.StudentScanData{
+		StudentID:      12,
+		FairID:         34,
+		FairDate:       sql.NullTime{Time: time.Date(2026, 9, 5, 18, 0, 0, 0, time.UTC), Valid: true},
+		Birthdate:      sql.NullString{String: "2008-03-09", Valid: true},
+		ScanTime:       sql.NullTime{Time: time.Date(2026, 9, 5, 18, 42, 7, 0, time.UTC), Valid: true},
+		FollowUp:       sql.NullBool{Bool: true, Valid: true},
+		TextPermission: sql.NullString{String: "1", Valid: true},
+		RaceAsian:      sql.NullString{String: "0", Valid: true},
+	}
+	row := slateRow(scan)
+	want := map[string]string{
+		"Ref":          "12-34",
+		"Event Date":   "09/05/2026",
+		"Birthdate":    "03/09/2008",
+		"Scan Date":    "09/05/2026 18:42",
+		"Updated Date": "",
+		"Follow Up":    "Y",
+		"SMS Opt-In":   "Y",
+		"Race Asian":   "N",
+		"Race White":   "N",
+	}
+	for header, value := range want {
+		if row[header] != value {
+			t.Errorf("%s = %q, want %q", header, row[header], value)
+		}
+	}
+
+	scan.FollowUp = sql.NullBool{Bool: false, Valid: true}
+	scan.Birthdate = sql.NullString{String: "spring 2008", Valid: true}
+	row = slateRow(scan)
+	if row["Follow Up"] != "N" {
+		t.Errorf("Follow Up = %q for false, want N", row["Follow Up"])
+	}
+	if row["Birthdate"] != "spring 2008" {
+		t.Errorf("unparseable Birthdate = %q, want it unchanged", row["Birthdate"])
+	}
+
+	scan.FollowUp = sql.NullBool{}
+	if row := slateRow(scan); row["Follow Up"] != "N" {
+		t.Errorf("Follow Up = %q for NULL, want N", row["Follow Up"])
+	}
+}
+
+func TestSlateDedupesByStudentAndFair(t *testing.T) {
+	scan := func(student, fair int64, rep string) models.StudentScanData {
+		return models.StudentScanData{TeamID: 1, StudentID: student, FairID: fair, ScanRep: sql.NullString{String: rep, Valid: true}}
+	}
+	grouped, err := SlateExportProfile().TransformData([]models.StudentScanData{
+		scan(12, 34, "first"),
+		scan(12, 35, "other fair"),
+		scan(12, 34, "second"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := grouped[1]
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows including the header, want 3", len(rows))
+	}
+	header := rows[0]
+	refs := map[string]string{}
+	for _, row := range rows[1:] {
+		values := zipRow(header, row)
+		refs[values["Ref"]] = values["Scan Rep"]
+	}
+	if refs["12-34"] != "second" || refs["12-35"] != "other fair" {
+		t.Errorf("rows by Ref = %v, want 12-34 from the later scan and 12-35 kept", refs)
+	}
+}
+
+func TestWriteSlateMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docs", "slate-mapping.csv")
+	if err := WriteSlateMapping(path); err != nil {
+		t.Fatalf("WriteSlateMapping: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(slateFields)+1 {
+		t.Fatalf("mapping has %d rows, want a header and %d fields", len(records), len(slateFields))
+	}
+	if want := []string{"Slate Field", "StriveScan Source", "Source Layout", "Format", "Notes"}; !slices.Equal(records[0], want) {
+		t.Errorf("header = %q, want %q", records[0], want)
+	}
+	if want := []string{"Ref", "student_id + fair_id", "Full profile", "Text, values joined with '-'", "Unique key for the person at this event"}; !slices.Equal(records[1], want) {
+		t.Errorf("Ref row = %q, want %q", records[1], want)
+	}
+	for i, field := range slateFields {
+		if records[i+1][0] != field.Header {
+			t.Errorf("row %d is %q, want %q", i+1, records[i+1][0], field.Header)
+		}
+	}
+}
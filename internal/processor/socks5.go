@@ -0,0 +1,253 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
+	"github.com/strivescan/strivescan-sftp/internal/secrets"
+)
+
+// socks5ProxyEnv names the SOCKS5 proxy used by teams that don't set one.
+const socks5ProxyEnv = "SFTP_SOCKS5_PROXY"
+
+// SOCKS5 protocol values (RFC 1928, RFC 1929)
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+	socks5PasswordAuth = 0x01
+)
+
+// socks5Replies describes the failure codes a proxy may send.
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Proxy is a parsed socks5_proxy setting. The credentials are secrets,
+// so printing the proxy can't reveal them.
+type socks5Proxy struct {
+	Addr     string
+	Username redact.Secret
+	Password redact.Secret
+}
+
+// parseSOCKS5Proxy parses "socks5://[user:password@]host[:port]". The port
+// defaults to 1080. socks5h is accepted as a synonym, since host names are
+// always resolved by the proxy. Only SFTP_SOCKS5_PROXY may carry credentials;
+// validateSettings refuses them in a team's settings.
+func parseSOCKS5Proxy(raw string) (*socks5Proxy, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		// url.Error quotes the whole URL, password included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid socks5_proxy: %w", err)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("socks5_proxy %q must use the socks5:// scheme", u.Redacted())
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("socks5_proxy %q has no host", u.Redacted())
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "1080"
+	}
+	proxy := &socks5Proxy{Addr: net.JoinHostPort(u.Hostname(), port)}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		if err := proxy.setCredentials(redact.Secret(u.User.Username()), redact.Secret(password)); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+// teamSOCKS5Proxy returns the proxy for a team: its socks5_proxy setting, or
+// SFTP_SOCKS5_PROXY, or nil for none. Credentials in the team's secrets take
+// the place of any in SFTP_SOCKS5_PROXY.
+func teamSOCKS5Proxy(settings models.SFTPSettings, teamSecrets *secrets.Credentials) (*socks5Proxy, error) {
+	raw := settings.SOCKS5Proxy
+	if raw == "" {
+		raw = os.Getenv(socks5ProxyEnv)
+	}
+	if raw == "" {
+		return nil, nil
+	}
+
+	proxy, err := parseSOCKS5Proxy(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !teamSecrets.SOCKS5Username.Empty() || !teamSecrets.SOCKS5Password.Empty() {
+		if err := proxy.setCredentials(teamSecrets.SOCKS5Username, teamSecrets.SOCKS5Password); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+// setCredentials sets the username and password sent to the proxy.
+func (p *socks5Proxy) setCredentials(username, password redact.Secret) error {
+	if username.Empty() {
+		return errors.New("a SOCKS5 password is set without a username")
+	}
+	if len(username) > 255 || len(password) > 255 {
+		return errors.New("SOCKS5 username and password must be at most 255 bytes")
+	}
+	p.Username, p.Password = username, password
+	return nil
+}
+
+// Dial connects to addr through the proxy. The timeout bounds reaching the
+// proxy and, separately, the negotiation.
+func (p *socks5Proxy) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", p.Addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach SOCKS5 proxy %s: %w", p.Addr, err)
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := p.handshake(conn, addr); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5 proxy %s could not connect to %s: %w", p.Addr, addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// handshake negotiates authentication and issues a CONNECT for addr.
+func (p *socks5Proxy) handshake(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	methods := []byte{socks5AuthNone}
+	if !p.Username.Empty() {
+		methods = []byte{socks5AuthPassword}
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if err := p.authenticate(conn); err != nil {
+			return err
+		}
+	case socks5NoAcceptable:
+		return errors.New("proxy accepted none of the offered authentication methods")
+	default:
+		return fmt.Errorf("proxy chose unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, socks5AddrIPv4), ip4...)
+		} else {
+			req = append(append(req, socks5AddrIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host name %q is too long", host)
+		}
+		req = append(append(req, socks5AddrDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", header[0])
+	}
+	if header[1] != 0x00 {
+		if msg, ok := socks5Replies[header[1]]; ok {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("proxy failed with code %d", header[1])
+	}
+
+	// Discard the bound address, whose length depends on its type
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("proxy replied with unknown address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// authenticate performs username/password authentication (RFC 1929).
+func (p *socks5Proxy) authenticate(conn net.Conn) error {
+	req := []byte{socks5PasswordAuth, byte(len(p.Username))}
+	req = append(req, p.Username...)
+	req = append(req, byte(len(p.Password)))
+	req = append(req, p.Password...)
+	defer wipeBytes(req)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		return errors.New("proxy rejected the username or password")
+	}
+	return nil
+}
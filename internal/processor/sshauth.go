@@ -0,0 +1,260 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/secrets"
+)
+
+// sshAuthSockEnv names the ssh-agent socket, as for OpenSSH.
+const sshAuthSockEnv = "SSH_AUTH_SOCK"
+
+// SSH auth methods accepted in the auth_order setting
+const (
+	AuthPublicKey           = "publickey"
+	AuthPassword            = "password"
+	AuthKeyboardInteractive = "keyboard-interactive"
+)
+
+// defaultAuthOrder is offered when a team sets no auth_order.
+var defaultAuthOrder = []string{AuthPublicKey, AuthPassword, AuthKeyboardInteractive}
+
+// maxKeyboardInteractiveRounds bounds the challenges answered in one
+// keyboard-interactive attempt, so a server that keeps re-prompting after a
+// wrong answer can't hold the connection open.
+const maxKeyboardInteractiveRounds = 5
+
+// validateAuthOrder checks auth_order names known methods, once each.
+func validateAuthOrder(order []string) error {
+	seen := make(map[string]bool)
+	for _, method := range order {
+		switch method {
+		case AuthPublicKey, AuthPassword, AuthKeyboardInteractive:
+		default:
+			return fmt.Errorf("unknown auth method %q in auth_order", method)
+		}
+		if seen[method] {
+			return fmt.Errorf("auth method %q appears twice in auth_order", method)
+		}
+		seen[method] = true
+	}
+	return nil
+}
+
+// authMethods builds the team's SSH auth methods in auth_order. The SSH client
+// tries them in that order and, when the server reports partial success,
+// continues with the next method it still requires. With the default order,
+// methods the team has no credentials for are left out; methods named in an
+// explicit auth_order must have credentials. When the agent is used its
+// connection is returned, to be closed once the handshake is done.
+func authMethods(creds models.SFTPCredentials, teamSecrets *secrets.Credentials, settings models.SFTPSettings) ([]ssh.AuthMethod, net.Conn, error) {
+	order := settings.AuthOrder
+	explicit := len(order) > 0
+	if !explicit {
+		order = defaultAuthOrder
+	}
+
+	signers, agentConn, err := teamSigners(creds, teamSecrets, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	methods := []ssh.AuthMethod{}
+	for _, method := range order {
+		var available bool
+		switch method {
+		case AuthPublicKey:
+			available = len(signers) > 0
+			if available {
+				methods = append(methods, ssh.PublicKeys(signers...))
+			}
+		case AuthPassword:
+			available = !teamSecrets.Password.Empty()
+			if available {
+				methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+					// The SSH library needs a string; it is only made when
+					// the server asks
+					return string(teamSecrets.Password), nil
+				}))
+			}
+		case AuthKeyboardInteractive:
+			available = !teamSecrets.Password.Empty()
+			if available {
+				methods = append(methods, ssh.KeyboardInteractive(keyboardInteractiveAnswers(creds.Username, teamSecrets)))
+			}
+		}
+		if explicit && !available {
+			if agentConn != nil {
+				agentConn.Close()
+			}
+			return nil, nil, fmt.Errorf("auth_order includes %s but the team has no credentials for it", method)
+		}
+	}
+	return methods, agentConn, nil
+}
+
+// keyboardInteractiveAnswers answers a server's prompts from the stored
+// credentials: password and passphrase prompts, or a lone hidden prompt, get
+// the password, and username or login prompts get the username. Any other
+// prompt fails the method rather than guessing. Answers are strings, as the
+// SSH library requires, so the password is copied only once a prompt asks
+// for it.
+func keyboardInteractiveAnswers(username string, teamSecrets *secrets.Credentials) ssh.KeyboardInteractiveChallenge {
+	rounds := 0
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		if len(questions) == 0 {
+			return []string{}, nil // Informational round, e.g. a banner
+		}
+		rounds++
+		if rounds > maxKeyboardInteractiveRounds {
+			return nil, fmt.Errorf("server sent more than %d keyboard-interactive challenges", maxKeyboardInteractiveRounds)
+		}
+
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			prompt := strings.ToLower(question)
+			switch {
+			case strings.Contains(prompt, "password"), strings.Contains(prompt, "passphrase"),
+				len(questions) == 1 && !echos[i]:
+				answers[i] = string(teamSecrets.Password)
+			case strings.Contains(prompt, "user"), strings.Contains(prompt, "login"):
+				answers[i] = username
+			default:
+				return nil, fmt.Errorf("no stored answer for keyboard-interactive prompt %q (one-time codes and Duo are not supported)", question)
+			}
+		}
+		return answers, nil
+	}
+}
+
+// teamSigners collects the keys offered for a team: its own key, then any
+// ssh-agent keys. With a certificate configured only the keys it certifies
+// are offered, each presented with the certificate. When the agent is used its
+// connection is returned, to be closed once the handshake is done.
+func teamSigners(creds models.SFTPCredentials, teamSecrets *secrets.Credentials, settings models.SFTPSettings) ([]ssh.Signer, net.Conn, error) {
+	signers := []ssh.Signer{}
+	signer, err := loadSigner(creds, teamSecrets)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load SSH key: %w", err)
+	}
+	if signer != nil {
+		signers = append(signers, signer)
+	}
+
+	var agentConn net.Conn
+	if settings.SSHAgent {
+		var keys []ssh.Signer
+		keys, agentConn, err = agentSigners()
+		if err != nil {
+			return nil, nil, err
+		}
+		signers = append(signers, keys...)
+	}
+
+	if settings.SSHCertificate == "" {
+		return signers, agentConn, nil
+	}
+
+	certSigners, err := certifiedSigners(settings.SSHCertificate, signers)
+	if err != nil {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, nil, err
+	}
+	return certSigners, agentConn, nil
+}
+
+// certifiedSigners pairs the named certificate with each signer whose key it
+// certifies.
+func certifiedSigners(name string, signers []ssh.Signer) ([]ssh.Signer, error) {
+	cert, err := loadCertificate(os.Getenv(sshKeyDirEnv), name)
+	if err != nil {
+		return nil, err
+	}
+
+	certSigners := []ssh.Signer{}
+	for _, signer := range signers {
+		if !bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+			continue
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use certificate %s: %w", name, err)
+		}
+		certSigners = append(certSigners, certSigner)
+	}
+	if len(certSigners) == 0 {
+		return nil, fmt.Errorf("certificate %s does not certify the team's SSH key or any agent key", name)
+	}
+	return certSigners, nil
+}
+
+// agentSigners returns the keys held by the ssh-agent at SSH_AUTH_SOCK,
+// along with the connection to close once they have been used.
+func agentSigners() ([]ssh.Signer, net.Conn, error) {
+	socket := os.Getenv(sshAuthSockEnv)
+	if socket == "" {
+		return nil, nil, fmt.Errorf("ssh_agent is enabled but %s is not set", sshAuthSockEnv)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	if len(signers) == 0 {
+		conn.Close()
+		return nil, nil, errors.New("ssh-agent holds no keys")
+	}
+	return signers, conn, nil
+}
+
+// loadCertificate reads an OpenSSH user certificate from the key directory
+// and checks it is currently valid.
+func loadCertificate(dir string, name string) (*ssh.Certificate, error) {
+	path, err := keyDirPath(dir, "ssh_certificate", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %s public key, not a certificate", path, pub.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("certificate %s is a host certificate, not a user certificate", path)
+	}
+
+	now := uint64(time.Now().Unix())
+	if now < cert.ValidAfter {
+		return nil, fmt.Errorf("certificate %s is not valid until %s", path, time.Unix(int64(cert.ValidAfter), 0).UTC().Format(time.RFC3339))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore {
+		return nil, fmt.Errorf("certificate %s expired at %s", path, time.Unix(int64(cert.ValidBefore), 0).UTC().Format(time.RFC3339))
+	}
+	return cert, nil
+}
@@ -0,0 +1,216 @@
+package processor
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// Connection defaults, used when a team leaves the setting at zero
+const (
+	defaultConnectTimeout    = 30 * time.Second
+	defaultIOTimeout         = 5 * time.Minute
+	defaultKeepaliveInterval = 30 * time.Second
+)
+
+// keepaliveRequest is the global request OpenSSH uses for ServerAliveInterval.
+const keepaliveRequest = "keepalive@openssh.com"
+
+// Default SSH algorithms, in preference order. They leave out SHA-1, CBC and
+// RC4, which teams with legacy servers can list explicitly.
+var (
+	defaultCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+	defaultKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+	}
+	defaultMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+	}
+	defaultHostKeyAlgorithms = []string{
+		ssh.KeyAlgoED25519,
+		ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+		ssh.CertAlgoED25519v01,
+		ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+		ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+	}
+)
+
+// legacyAlgorithms are supported by the SSH library but only offered when a
+// team lists them.
+var (
+	legacyCiphers           = []string{"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour"}
+	legacyKeyExchanges      = []string{"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1", "diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1"}
+	legacyMACs              = []string{"hmac-sha1", "hmac-sha1-96"}
+	legacyHostKeyAlgorithms = []string{ssh.KeyAlgoRSA, ssh.KeyAlgoDSA, ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01}
+)
+
+// sshTimeouts are a team's connection timeouts with defaults applied. A zero
+// keepalive disables it.
+type sshTimeouts struct {
+	Connect   time.Duration
+	IO        time.Duration
+	Keepalive time.Duration
+}
+
+// timeoutsFor applies the defaults to a team's timeout settings.
+func timeoutsFor(settings models.SFTPSettings) sshTimeouts {
+	t := sshTimeouts{
+		Connect:   time.Duration(settings.ConnectTimeout) * time.Second,
+		IO:        time.Duration(settings.IOTimeout) * time.Second,
+		Keepalive: time.Duration(settings.KeepaliveInterval) * time.Second,
+	}
+	if t.Connect == 0 {
+		t.Connect = defaultConnectTimeout
+	}
+	if t.IO == 0 {
+		t.IO = defaultIOTimeout
+	}
+	if t.Keepalive == 0 {
+		t.Keepalive = defaultKeepaliveInterval
+	} else if t.Keepalive < 0 {
+		t.Keepalive = 0
+	}
+	return t
+}
+
+// applyAlgorithms sets the team's algorithm allow-lists, or the defaults, on
+// config.
+func applyAlgorithms(config *ssh.ClientConfig, settings models.SFTPSettings) {
+	config.Ciphers = orDefault(settings.Ciphers, defaultCiphers)
+	config.KeyExchanges = orDefault(settings.KeyExchanges, defaultKeyExchanges)
+	config.MACs = orDefault(settings.MACs, defaultMACs)
+	config.HostKeyAlgorithms = orDefault(settings.HostKeyAlgorithms, defaultHostKeyAlgorithms)
+}
+
+func orDefault(list []string, def []string) []string {
+	if len(list) == 0 {
+		return def
+	}
+	return list
+}
+
+// validateSSHOptions checks the timeout settings and that every listed
+// algorithm is one the SSH library implements, since it silently drops
+// names it doesn't know.
+func validateSSHOptions(settings models.SFTPSettings) error {
+	if settings.ConnectTimeout < 0 {
+		return fmt.Errorf("connect_timeout must not be negative")
+	}
+	if settings.IOTimeout < 0 {
+		return fmt.Errorf("io_timeout must not be negative")
+	}
+	t := timeoutsFor(settings)
+	if t.Keepalive > 0 && t.Keepalive >= t.IO {
+		return fmt.Errorf("keepalive_interval (%s) must be shorter than io_timeout (%s)", t.Keepalive, t.IO)
+	}
+
+	lists := []struct {
+		setting string
+		values  []string
+		known   [][]string
+	}{
+		{"ciphers", settings.Ciphers, [][]string{defaultCiphers, legacyCiphers}},
+		{"key_exchanges", settings.KeyExchanges, [][]string{defaultKeyExchanges, legacyKeyExchanges}},
+		{"macs", settings.MACs, [][]string{defaultMACs, legacyMACs}},
+		{"host_key_algorithms", settings.HostKeyAlgorithms, [][]string{defaultHostKeyAlgorithms, legacyHostKeyAlgorithms}},
+	}
+	for _, list := range lists {
+		for _, value := range list.values {
+			if !containsAny(list.known, value) {
+				return fmt.Errorf("unsupported algorithm %q in %s", value, list.setting)
+			}
+		}
+	}
+	return nil
+}
+
+func containsAny(lists [][]string, value string) bool {
+	for _, list := range lists {
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deadlineConn gives every read and write on a connection its own deadline,
+// so a server that stops responding fails the operation instead of stalling
+// the run. Keepalives keep reads on an idle session inside the read deadline;
+// without them an idle session would time out, so a zero readTimeout leaves
+// reads without a deadline.
+type deadlineConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// newDeadlineConn applies the team's I/O timeout to conn, to reads only when
+// keepalives are enabled.
+func newDeadlineConn(conn net.Conn, timeouts sshTimeouts) *deadlineConn {
+	c := &deadlineConn{Conn: conn, writeTimeout: timeouts.IO}
+	if timeouts.Keepalive > 0 {
+		c.readTimeout = timeouts.IO
+	}
+	return c
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// startKeepalive sends keepalive requests on client every interval until the
+// connection closes, closing it when a request fails. A zero interval does
+// nothing.
+func startKeepalive(client *ssh.Client, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(done)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, _, err := client.SendRequest(keepaliveRequest, true, nil); err != nil {
+					client.Close()
+					return
+				}
+			}
+		}
+	}()
+}
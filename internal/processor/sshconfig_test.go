@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeadlineConnReadTimeoutFollowsKeepalive(t *testing.T) {
+	const ioTimeout = 50 * time.Millisecond
+
+	t.Run("keepalive enabled", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+		conn := newDeadlineConn(client, sshTimeouts{IO: ioTimeout, Keepalive: 10 * time.Millisecond})
+		defer conn.Close()
+
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("idle read: got %v, want a deadline error", err)
+		}
+	})
+
+	t.Run("keepalive disabled", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+		conn := newDeadlineConn(client, sshTimeouts{IO: ioTimeout})
+		defer conn.Close()
+
+		go func() {
+			time.Sleep(3 * ioTimeout)
+			server.Write([]byte{1})
+		}()
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Errorf("read idle for longer than io_timeout: %v", err)
+		}
+
+		if _, err := conn.Write([]byte{1}); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("unread write: got %v, want a deadline error", err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package processor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/strivescan/strivescan-sftp/internal/logging"
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/secrets"
+)
+
+// knownHostsEnv names an OpenSSH known_hosts file. When it is set every host
+// key, at each hop, must be listed in it; proxied connections require it.
+const knownHostsEnv = "SSH_KNOWN_HOSTS"
+
+// jumpHost is one hop of a proxy_jump chain.
+type jumpHost struct {
+	User string // Empty uses the team's username
+	Addr string
+}
+
+// parseProxyJump parses a comma-separated "[user@]host[:port]" chain. The
+// port defaults to 22.
+func parseProxyJump(raw string) ([]jumpHost, error) {
+	hops := []jumpHost{}
+	if strings.TrimSpace(raw) == "" {
+		return hops, nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		var hop jumpHost
+		if at := strings.LastIndex(entry, "@"); at >= 0 {
+			hop.User, entry = entry[:at], entry[at+1:]
+		}
+
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			host, port = strings.Trim(entry, "[]"), "22"
+		}
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			return nil, fmt.Errorf("invalid proxy_jump host %q", entry)
+		}
+		hop.Addr = net.JoinHostPort(host, port)
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// hostKeyCallback returns the host key check applied to the server and every
+// hop: the known_hosts file in SSH_KNOWN_HOSTS. Without it a connection
+// through proxy_jump or a SOCKS5 proxy is refused, since a hop or proxy could
+// otherwise stand in for the server unnoticed; a direct connection goes ahead
+// unchecked with a warning.
+func hostKeyCallback(settings models.SFTPSettings) (ssh.HostKeyCallback, error) {
+	path := os.Getenv(knownHostsEnv)
+	if path == "" {
+		if strings.TrimSpace(settings.ProxyJump) != "" || settings.SOCKS5Proxy != "" || os.Getenv(socks5ProxyEnv) != "" {
+			return nil, fmt.Errorf("%s must be set to connect through proxy_jump or a SOCKS5 proxy", knownHostsEnv)
+		}
+		logging.Yellow("Warning: %s is not set, so the server's host key is not checked", knownHostsEnv)
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", knownHostsEnv, err)
+	}
+	return callback, nil
+}
+
+// dialSSH connects to addr with config, through the team's SOCKS5 proxy and
+// proxy_jump hops if set. The proxy credentials come from teamSecrets. Each hop uses the same host key check, algorithms
+// and timeouts as the server, and authenticates with a fresh set of methods
+// from newAuth, so per-connection state such as the keyboard-interactive
+// round count isn't shared between connections. The hop clients are returned
+// in dial order and must be closed after the returned client.
+func dialSSH(addr string, config *ssh.ClientConfig, settings models.SFTPSettings, teamSecrets *secrets.Credentials, newAuth func() ([]ssh.AuthMethod, error)) (*ssh.Client, []*ssh.Client, error) {
+	hops, err := parseProxyJump(settings.ProxyJump)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeouts := timeoutsFor(settings)
+
+	connect := func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, timeouts.Connect)
+	}
+	proxy, err := teamSOCKS5Proxy(settings, teamSecrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if proxy != nil {
+		connect = func(addr string) (net.Conn, error) {
+			return proxy.Dial(addr, timeouts.Connect)
+		}
+	}
+
+	// Later hops tunnel through the first connection, so its deadlines
+	// cover the whole chain
+	dial := func(addr string) (net.Conn, error) {
+		conn, err := connect(addr)
+		if err != nil {
+			return nil, err
+		}
+		return newDeadlineConn(conn, timeouts), nil
+	}
+
+	hopClients := []*ssh.Client{}
+	closeHops := func() {
+		for i := len(hopClients) - 1; i >= 0; i-- {
+			hopClients[i].Close()
+		}
+	}
+
+	for _, hop := range hops {
+		hopConfig := *config
+		if hop.User != "" {
+			hopConfig.User = hop.User
+		}
+		hopConfig.Auth, err = newAuth()
+		if err != nil {
+			closeHops()
+			return nil, nil, fmt.Errorf("failed to set up authentication for jump host %s: %w", hop.Addr, err)
+		}
+		client, err := sshClient(dial, hop.Addr, &hopConfig, timeouts)
+		if err != nil {
+			closeHops()
+			return nil, nil, fmt.Errorf("failed to connect to jump host %s: %w", hop.Addr, err)
+		}
+		hopClients = append(hopClients, client)
+		dial = func(addr string) (net.Conn, error) {
+			return client.Dial("tcp", addr)
+		}
+	}
+
+	client, err := sshClient(dial, addr, config, timeouts)
+	if err != nil {
+		closeHops()
+		return nil, nil, err
+	}
+	return client, hopClients, nil
+}
+
+// sshClient opens an SSH connection to addr over a connection from dial and
+// starts its keepalives. The handshake must finish within the connect
+// timeout; the connection is closed to abort it otherwise.
+func sshClient(dial func(string) (net.Conn, error), addr string, config *ssh.ClientConfig, timeouts sshTimeouts) (*ssh.Client, error) {
+	conn, err := dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.AfterFunc(timeouts.Connect, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !timer.Stop() {
+		if c != nil {
+			c.Close()
+		}
+		return nil, fmt.Errorf("SSH handshake with %s timed out after %s", addr, timeouts.Connect)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client := ssh.NewClient(c, chans, reqs)
+	startKeepalive(client, timeouts.Keepalive)
+	return client, nil
+}
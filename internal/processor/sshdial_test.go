@@ -0,0 +1,212 @@
+package processor
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
+	"github.com/strivescan/strivescan-sftp/internal/secrets"
+)
+
+// testSSHServer starts an SSH server that asks each connection rounds
+// keyboard-interactive password challenges and forwards direct-tcpip
+// channels, so it can act as its own jump host. It returns the address and
+// the server's host key.
+func testSSHServer(t *testing.T, password string, rounds int) (string, ssh.PublicKey) {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			for i := 0; i < rounds; i++ {
+				answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+				if err != nil {
+					return nil, err
+				}
+				if len(answers) != 1 || answers[0] != password {
+					return nil, errors.New("wrong password")
+				}
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSH(conn, config)
+		}
+	}()
+	return listener.Addr().String(), signer.PublicKey()
+}
+
+func serveTestSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelReqs, err := newChannel.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelReqs)
+		go func() {
+			io.Copy(channel, upstream)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(upstream, channel)
+			upstream.Close()
+		}()
+	}
+}
+
+// TestDialSSHFreshAuthPerHop connects through a jump host where every
+// connection takes three keyboard-interactive rounds. Sharing one round
+// counter across the two connections would exceed the limit of five.
+func TestDialSSHFreshAuthPerHop(t *testing.T) {
+	t.Setenv(socks5ProxyEnv, "")
+	addr, _ := testSSHServer(t, "pw", 3)
+
+	creds := models.SFTPCredentials{TeamID: 1, Username: "team"}
+	teamSecrets := &secrets.Credentials{Password: redact.Secret("pw")}
+	settings := models.SFTPSettings{AuthOrder: []string{AuthKeyboardInteractive}, ProxyJump: addr}
+
+	built := 0
+	newAuth := func() ([]ssh.AuthMethod, error) {
+		built++
+		auth, _, err := authMethods(creds, teamSecrets, settings)
+		return auth, err
+	}
+	auth, err := newAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ClientConfig{User: creds.Username, Auth: auth, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	client, hops, err := dialSSH(addr, config, settings, teamSecrets, newAuth)
+	if err != nil {
+		t.Fatalf("dialSSH: %v", err)
+	}
+	client.Close()
+	for _, hop := range hops {
+		hop.Close()
+	}
+	if len(hops) != 1 || built != 2 {
+		t.Errorf("got %d hops and %d sets of auth methods, want 1 and 2", len(hops), built)
+	}
+}
+
+// TestDialSSHRejectsUnknownHopKey lists only the server's host key in
+// known_hosts, so the jump host in front of it must be refused.
+func TestDialSSHRejectsUnknownHopKey(t *testing.T) {
+	t.Setenv(socks5ProxyEnv, "")
+	hopAddr, _ := testSSHServer(t, "pw", 1)
+	addr, hostKey := testSSHServer(t, "pw", 1)
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(knownHostsEnv, knownHosts)
+
+	creds := models.SFTPCredentials{TeamID: 1, Username: "team"}
+	teamSecrets := &secrets.Credentials{Password: redact.Secret("pw")}
+	settings := models.SFTPSettings{AuthOrder: []string{AuthKeyboardInteractive}, ProxyJump: hopAddr}
+
+	hostKeys, err := hostKeyCallback(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAuth := func() ([]ssh.AuthMethod, error) {
+		auth, _, err := authMethods(creds, teamSecrets, settings)
+		return auth, err
+	}
+	auth, err := newAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ClientConfig{User: creds.Username, Auth: auth, HostKeyCallback: hostKeys}
+
+	client, hops, err := dialSSH(addr, config, settings, teamSecrets, newAuth)
+	if err == nil {
+		client.Close()
+		for _, hop := range hops {
+			hop.Close()
+		}
+		t.Fatal("dialSSH accepted a jump host missing from known_hosts")
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		t.Errorf("got %v, want a known_hosts key error", err)
+	}
+}
+
+func TestHostKeyCallbackRequiresKnownHostsWhenProxied(t *testing.T) {
+	t.Setenv(knownHostsEnv, "")
+	t.Setenv(socks5ProxyEnv, "")
+
+	for _, settings := range []models.SFTPSettings{
+		{ProxyJump: "jump.example.com"},
+		{SOCKS5Proxy: "socks5://proxy.example.com:1080"},
+	} {
+		if _, err := hostKeyCallback(settings); err == nil {
+			t.Errorf("%+v: got no error without %s", settings, knownHostsEnv)
+		}
+	}
+	if _, err := hostKeyCallback(models.SFTPSettings{}); err != nil {
+		t.Errorf("direct connection: %v", err)
+	}
+}
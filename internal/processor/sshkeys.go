@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/secrets"
+)
+
+// sshKeyDirEnv names the directory holding key files referenced by
+// ssh_key_filename.
+const sshKeyDirEnv = "SSH_KEY_DIR"
+
+// loadSigner returns the signer for a team's private key. A key file named by
+// ssh_key_filename takes precedence over the ssh_key column; the passphrase
+// applies to either. It returns nil when the team has no key.
+func loadSigner(creds models.SFTPCredentials, teamSecrets *secrets.Credentials) (ssh.Signer, error) {
+	if creds.SSHKeyFilename.Valid && creds.SSHKeyFilename.String != "" {
+		data, err := readKeyFile(os.Getenv(sshKeyDirEnv), creds.SSHKeyFilename.String)
+		if err != nil {
+			return nil, err
+		}
+		defer wipeBytes(data)
+		return parsePrivateKey(data, teamSecrets.Passphrase)
+	}
+
+	if !teamSecrets.SSHKey.Empty() {
+		return parsePrivateKey(teamSecrets.SSHKey, teamSecrets.Passphrase)
+	}
+	return nil, nil
+}
+
+// keyDirPath resolves name, taken from the given setting, inside the key
+// directory. The directory must not be writable by others, since they could
+// swap the files in it.
+func keyDirPath(dir string, setting string, name string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("%s %q is set but %s is not", setting, name, sshKeyDirEnv)
+	}
+	if !isPlainFilename(name) {
+		return "", fmt.Errorf("%s %q must be a plain file name inside %s", setting, name, sshKeyDirEnv)
+	}
+
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key directory: %w", err)
+	}
+	if !dirInfo.IsDir() {
+		return "", fmt.Errorf("key directory %s is not a directory", dir)
+	}
+	if perm := dirInfo.Mode().Perm(); perm&0022 != 0 {
+		return "", fmt.Errorf("key directory %s has permissions %04o; it must not be group or world writable", dir, perm)
+	}
+
+	path := filepath.Join(dir, name)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return path, nil
+}
+
+// isPlainFilename reports whether name is a bare file name, with no directory
+// part that could escape the key directory.
+func isPlainFilename(name string) bool {
+	return filepath.IsLocal(name) && filepath.Base(name) == name
+}
+
+// readKeyFile reads a private key from the key directory. Like OpenSSH, it
+// refuses a key that anyone but its owner can access.
+func readKeyFile(dir string, name string) ([]byte, error) {
+	path, err := keyDirPath(dir, "ssh_key_filename", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("key file %s has permissions %04o; it must be 0600 or stricter", path, perm)
+	}
+
+	return os.ReadFile(path)
+}
+
+// parsePrivateKey parses an OpenSSH, PEM (PKCS#1, PKCS#8, SEC 1) or PuTTY PPK
+// private key, decrypting it with passphrase when the key is protected.
+func parsePrivateKey(data []byte, passphrase []byte) (ssh.Signer, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(ppkHeaderPrefix)) {
+		return parsePPK(data, passphrase)
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("the SSH key is passphrase protected but no passphrase is set")
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, errors.New("the passphrase does not decrypt the SSH key")
+	}
+	return signer, err
+}
+
+// wipeBytes overwrites b with zeros.
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,171 @@
+// Command ppkgen writes the generated PuTTY key fixtures in the parent
+// directory: one RSA, one ECDSA P-256 and one Ed25519 key in formats 2 and 3,
+// plain and encrypted with "correct horse", plus an Ed25519 key whose seed
+// PuTTY would write short. It follows the format description in PuTTY's
+// sshpubk.c and does not share code with ppk.go. Keys are random, so rerunning
+// it means updating the fingerprints in ppk_test.go.
+//
+//	cd internal/processor/testdata && go run ./ppkgen
+//
+// The ppk*-putty.ppk fixtures were written by PuTTY itself and come from its
+// test suite; ppkgen does not touch them. Keys made by puttygen can replace
+// the generated ones, e.g.
+//
+//	puttygen -t ecdsa -b 256 --ppk-param version=2 -o ppk2-ecdsa-encrypted.ppk
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+func str(b []byte) []byte {
+	out := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(out, uint32(len(b)))
+	copy(out[4:], b)
+	return out
+}
+
+func mpint(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return str(b)
+}
+
+func lines(b []byte) []string {
+	s := base64.StdEncoding.EncodeToString(b)
+	out := []string{}
+	for len(s) > 64 {
+		out = append(out, s[:64])
+		s = s[64:]
+	}
+	return append(out, s)
+}
+
+func write(name string, version int, alg, comment string, pub, priv []byte, pass string) {
+	enc := "none"
+	if pass != "" {
+		enc = "aes256-cbc"
+	}
+	var kdf []string
+	var ck, iv, mk []byte
+	if version == 2 {
+		h := sha1.New()
+		h.Write([]byte("putty-private-key-file-mac-key"))
+		h.Write([]byte(pass))
+		mk = h.Sum(nil)
+		if pass != "" {
+			for i := 0; i < 2; i++ {
+				h := sha1.New()
+				h.Write([]byte{0, 0, 0, byte(i)})
+				h.Write([]byte(pass))
+				ck = h.Sum(ck)
+			}
+			ck = ck[:32]
+			iv = make([]byte, 16)
+		}
+	} else if pass != "" {
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		d := argon2.IDKey([]byte(pass), salt, 2, 8192, 1, 80)
+		ck, iv, mk = d[:32], d[32:48], d[48:]
+		kdf = []string{"Key-Derivation: Argon2id", "Argon2-Memory: 8192", "Argon2-Passes: 2", "Argon2-Parallelism: 1", "Argon2-Salt: " + hex.EncodeToString(salt)}
+	}
+	if pass != "" {
+		pad := make([]byte, (16-len(priv)%16)%16)
+		rand.Read(pad)
+		priv = append(priv, pad...)
+	}
+	var nh func() hash.Hash = sha256.New
+	if version == 2 {
+		nh = sha1.New
+	}
+	m := hmac.New(nh, mk)
+	for _, f := range [][]byte{[]byte(alg), []byte(enc), []byte(comment), pub, priv} {
+		m.Write(str(f))
+	}
+	mac := m.Sum(nil)
+	out := priv
+	if ck != nil {
+		block, _ := aes.NewCipher(ck)
+		out = make([]byte, len(priv))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, priv)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "PuTTY-User-Key-File-%d: %s\r\nEncryption: %s\r\nComment: %s\r\n", version, alg, enc, comment)
+	pl := lines(pub)
+	fmt.Fprintf(&b, "Public-Lines: %d\r\n%s\r\n", len(pl), strings.Join(pl, "\r\n"))
+	for _, l := range kdf {
+		b.WriteString(l + "\r\n")
+	}
+	xl := lines(out)
+	fmt.Fprintf(&b, "Private-Lines: %d\r\n%s\r\n", len(xl), strings.Join(xl, "\r\n"))
+	fmt.Fprintf(&b, "Private-MAC: %s\r\n", hex.EncodeToString(mac))
+	if err := os.WriteFile(name, []byte(b.String()), 0600); err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rpub, _ := ssh.NewPublicKey(&rk.PublicKey)
+	iqmp := new(big.Int).ModInverse(rk.Primes[1], rk.Primes[0])
+	rpriv := append(append(append(mpint(rk.D), mpint(rk.Primes[0])...), mpint(rk.Primes[1])...), mpint(iqmp)...)
+
+	ck, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cpub, _ := ssh.NewPublicKey(&ck.PublicKey)
+
+	seed := make([]byte, 32)
+	rand.Read(seed)
+	ek := ed25519.NewKeyFromSeed(seed)
+	epub, _ := ssh.NewPublicKey(ek.Public())
+
+	// PuTTY writes the Ed25519 seed as a little-endian integer, so its high
+	// zero bytes are dropped; short[30:] is zero and only 30 bytes are kept
+	short := make([]byte, 32)
+	rand.Read(short)
+	short[31] = 0
+	short[30] = 0
+	sk := ed25519.NewKeyFromSeed(short)
+	spub, _ := ssh.NewPublicKey(sk.Public())
+
+	for _, v := range []int{2, 3} {
+		for _, p := range []string{"", "correct horse"} {
+			kind := "plain"
+			if p != "" {
+				kind = "encrypted"
+			}
+			write(fmt.Sprintf("ppk%d-rsa-%s.ppk", v, kind), v, "ssh-rsa", "rsa-key-20261018", rpub.Marshal(), rpriv, p)
+			write(fmt.Sprintf("ppk%d-ecdsa-%s.ppk", v, kind), v, "ecdsa-sha2-nistp256", "ecdsa-key-20261018", cpub.Marshal(), mpint(ck.D), p)
+			write(fmt.Sprintf("ppk%d-ed25519-%s.ppk", v, kind), v, "ssh-ed25519", "ed25519-key-20261018", epub.Marshal(), str(seed), p)
+		}
+	}
+	write("ppk3-ed25519-short-seed.ppk", 3, "ssh-ed25519", "ed25519-key-20261018", spub.Marshal(), str(short[:30]), "")
+
+	fmt.Println(ssh.FingerprintSHA256(rpub))
+	fmt.Println(ssh.FingerprintSHA256(cpub))
+	fmt.Println(ssh.FingerprintSHA256(epub))
+	fmt.Println(ssh.FingerprintSHA256(spub))
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// Verification modes accepted in the verify setting
+const (
+	VerifySize = "size"
+	VerifyHash = "hash"
+)
+
+// defaultUploadRetries is used when a team doesn't set upload_retries.
+const defaultUploadRetries = 2
+
+// uploadAttempts returns how often a file is tried: once, plus the team's
+// upload_retries or the default when it is unset.
+func uploadAttempts(settings models.SFTPSettings) int {
+	if settings.UploadRetries == nil {
+		return defaultUploadRetries + 1
+	}
+	return *settings.UploadRetries + 1
+}
+
+// uploadRetryDelay is multiplied by the attempt number between retries.
+const uploadRetryDelay = 2 * time.Second
+
+// verifyUpload checks that remotePath matches localPath. The remote size is
+// always compared; in hash mode the file is also read back and its SHA-256
+// compared, for servers known to truncate silently.
+func verifyUpload(client *sftp.Client, localPath string, remotePath string, mode string) error {
+	localInfo, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat local file %s: %w", localPath, err)
+	}
+
+	remoteInfo, err := client.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat remote file %s: %w", remotePath, err)
+	}
+	if remoteInfo.Size() != localInfo.Size() {
+		return fmt.Errorf("size mismatch for %s: local %d bytes, remote %d bytes", remotePath, localInfo.Size(), remoteInfo.Size())
+	}
+
+	if mode != VerifyHash {
+		return nil
+	}
+
+	localSum, _, err := fileSHA256(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash local file %s: %w", localPath, err)
+	}
+
+	remoteFile, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file %s for verification: %w", remotePath, err)
+	}
+	defer remoteFile.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, remoteFile); err != nil {
+		return fmt.Errorf("failed to read back remote file %s: %w", remotePath, err)
+	}
+	if remoteSum := hex.EncodeToString(h.Sum(nil)); remoteSum != localSum {
+		return fmt.Errorf("checksum mismatch for %s: local %s, remote %s", remotePath, localSum, remoteSum)
+	}
+
+	return nil
+}
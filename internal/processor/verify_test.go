@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestUploadAttempts(t *testing.T) {
+	tests := []struct {
+		settings string
+		want     int
+	}{
+		{`{}`, defaultUploadRetries + 1},
+		{`{"upload_retries": null}`, defaultUploadRetries + 1},
+		{`{"upload_retries": 0}`, 1},
+		{`{"upload_retries": 4}`, 5},
+	}
+
+	for _, tc := range tests {
+		settings, err := parseSettings(sql.NullString{String: tc.settings, Valid: true})
+		if err != nil {
+			t.Fatalf("parseSettings(%s): %v", tc.settings, err)
+		}
+		if got := uploadAttempts(settings); got != tc.want {
+			t.Errorf("uploadAttempts(%s) = %d, want %d", tc.settings, got, tc.want)
+		}
+	}
+
+	if _, err := parseSettings(sql.NullString{String: `{"upload_retries": -1}`, Valid: true}); err == nil {
+		t.Error("negative upload_retries was accepted")
+	}
+}
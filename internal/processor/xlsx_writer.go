@@ -0,0 +1,305 @@
+package processor
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell style indexes into the cellXfs list of xlsxStyles
+const (
+	xlsxStyleDefault  = 0
+	xlsxStyleText     = 1
+	xlsxStyleDateTime = 2
+	xlsxStyleHeader   = 3
+)
+
+// xlsxMaxSheetName is Excel's limit on worksheet name length.
+const xlsxMaxSheetName = 31
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="49" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="49" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>
+`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>
+`
+
+// xlsxSheet is a named group of data rows written to one worksheet.
+type xlsxSheet struct {
+	Name string
+	Rows [][]string
+}
+
+// WriteXLSXFile writes the team data as an Excel workbook with one sheet per
+// fair. String columns are text-typed so codes and phone numbers keep their
+// leading zeros, timestamps are real date cells, and the header row is frozen.
+func (bp *BaseProcessor) WriteXLSXFile(teamID int64, teamData [][]string, fp string) (string, error) {
+	if len(teamData) <= 1 { // Skip teams with only a header row
+		return "", fmt.Errorf("no data rows for team %d", teamID)
+	}
+
+	file, err := createExportFile(fp)
+	if err != nil {
+		return "", fmt.Errorf("failed to create XLSX file '%s' for team %d: %w", fp, teamID, err)
+	}
+	defer file.Close()
+
+	header := teamData[0]
+	sheets := splitSheetsByFair(header, teamData[1:])
+
+	zw := zip.NewWriter(file)
+	if err := writeXLSXPackage(zw, header, sheets); err != nil {
+		return "", fmt.Errorf("failed to write XLSX data for team %d to '%s': %w", teamID, fp, err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to finish XLSX file '%s' for team %d: %w", fp, teamID, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to close XLSX file '%s' for team %d: %w", fp, teamID, err)
+	}
+
+	return fp, nil
+}
+
+// splitSheetsByFair groups rows by their fair column, keeping the order in which
+// fairs first appear. Without a fair column all rows go to a single sheet.
+func splitSheetsByFair(header []string, rows [][]string) []xlsxSheet {
+	fairCol := fairColumn(header)
+	if fairCol < 0 {
+		return []xlsxSheet{{Name: "Scans", Rows: rows}}
+	}
+
+	sheets := []xlsxSheet{}
+	index := make(map[string]int) // fair -> position in sheets
+	used := make(map[string]bool) // sheet names already taken
+	for _, row := range rows {
+		fair := ""
+		if fairCol < len(row) {
+			fair = cellText(row[fairCol])
+		}
+		i, ok := index[fair]
+		if !ok {
+			i = len(sheets)
+			index[fair] = i
+			sheets = append(sheets, xlsxSheet{Name: uniqueSheetName(fair, used)})
+		}
+		sheets[i].Rows = append(sheets[i].Rows, row)
+	}
+	return sheets
+}
+
+// uniqueSheetName strips the characters Excel forbids in sheet names, truncates
+// to the length limit and adds a counter if the name is already taken.
+func uniqueSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.Join(strings.Fields(name), " "), "'")
+	if name == "" {
+		name = "Scans"
+	}
+
+	candidate := truncateRunes(name, xlsxMaxSheetName)
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate = truncateRunes(name, xlsxMaxSheetName-len(suffix)) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) > max {
+		return strings.TrimSpace(string(runes[:max]))
+	}
+	return s
+}
+
+// writeXLSXPackage writes every part of the workbook to the zip archive.
+func writeXLSXPackage(zw *zip.Writer, header []string, sheets []xlsxSheet) error {
+	kinds := make([]columnKind, len(header))
+	for i, h := range header {
+		kinds[i] = columnKinds[h]
+	}
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>
+`)
+	workbookRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`+"\n", xmlEscape(sheet.Name), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", n, n)
+
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", n))
+		if err != nil {
+			return err
+		}
+		if err := writeXLSXSheet(w, header, kinds, sheet.Rows); err != nil {
+			return fmt.Errorf("sheet %q: %w", sheet.Name, err)
+		}
+	}
+
+	contentTypes.WriteString("</Types>\n")
+	workbook.WriteString("</sheets>\n</workbook>\n")
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(sheets)+1)
+	workbookRels.WriteString("</Relationships>\n")
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeXLSXSheet writes a worksheet with a frozen header row followed by rows.
+func writeXLSXSheet(w io.Writer, header []string, kinds []columnKind, rows [][]string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft"/></sheetView></sheetViews>
+<cols>`)
+	for i, kind := range kinds {
+		style, width := xlsxStyleText, 18
+		switch kind {
+		case kindInt, kindBool:
+			style, width = xlsxStyleDefault, 12
+		case kindTime:
+			style, width = xlsxStyleDateTime, 20
+		}
+		fmt.Fprintf(bw, `<col min="%d" max="%d" width="%d" style="%d" customWidth="1"/>`, i+1, i+1, width, style)
+	}
+	bw.WriteString("</cols>\n<sheetData>\n")
+
+	bw.WriteString(`<row r="1">`)
+	for i, h := range header {
+		writeXLSXString(bw, xlsxCellRef(i, 1), h, xlsxStyleHeader)
+	}
+	bw.WriteString("</row>\n")
+
+	for r, row := range rows {
+		rowNum := r + 2
+		fmt.Fprintf(bw, `<row r="%d">`, rowNum)
+		for i, value := range row {
+			if value == "" || value == nullCell {
+				continue
+			}
+			kind := kindString
+			if i < len(kinds) {
+				kind = kinds[i]
+			}
+			writeXLSXCell(bw, xlsxCellRef(i, rowNum), kind, value)
+		}
+		bw.WriteString("</row>\n")
+	}
+
+	bw.WriteString("</sheetData>\n</worksheet>\n")
+	return bw.Flush()
+}
+
+// writeXLSXCell writes a single typed cell, falling back to text for values
+// that don't parse as their column kind.
+func writeXLSXCell(w *bufio.Writer, ref string, kind columnKind, value string) {
+	switch kind {
+	case kindInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			fmt.Fprintf(w, `<c r="%s"><v>%s</v></c>`, ref, value)
+			return
+		}
+	case kindBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			v := 0
+			if b {
+				v = 1
+			}
+			fmt.Fprintf(w, `<c r="%s" t="b"><v>%d</v></c>`, ref, v)
+			return
+		}
+	case kindTime:
+		if t, err := time.Parse("2006-01-02 15:04:05", value); err == nil {
+			fmt.Fprintf(w, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleDateTime, strconv.FormatFloat(excelSerial(t), 'f', -1, 64))
+			return
+		}
+	}
+	writeXLSXString(w, ref, value, xlsxStyleText)
+}
+
+func writeXLSXString(w *bufio.Writer, ref string, value string, style int) {
+	fmt.Fprintf(w, `<c r="%s" t="inlineStr" s="%d"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(value))
+}
+
+// excelSerial converts a wall-clock time to an Excel serial date number.
+func excelSerial(t time.Time) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(epoch).Seconds() / 86400
+}
+
+// xlsxCellRef returns the A1-style reference of a zero-based column and row number.
+func xlsxCellRef(col int, row int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name + strconv.Itoa(row)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package processor
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type xlsxTestWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxTestCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type xlsxTestWorksheet struct {
+	Pane struct {
+		YSplit      string `xml:"ySplit,attr"`
+		TopLeftCell string `xml:"topLeftCell,attr"`
+		State       string `xml:"state,attr"`
+	} `xml:"sheetViews>sheetView>pane"`
+	Rows []struct {
+		Ref   string         `xml:"r,attr"`
+		Cells []xlsxTestCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXPart decodes the named XML part of the workbook into v.
+func readXLSXPart(t *testing.T, zr *zip.ReadCloser, name string, v interface{}) {
+	t.Helper()
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := xml.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return
+	}
+	t.Fatalf("the workbook has no %s", name)
+}
+
+func TestWriteXLSXFile(t *testing.T) {
+	long := "Greater Toronto Area Fall University Fair"
+	teamData := [][]string{
+		{"Fair Name", "First Name", "Rating", "Scan Time", "Notes"},
+		{"Boston/Cambridge", "0042", "4", "2025-03-04 12:00:00", `<b>&"Tom"` + "\x01\tend"},
+		{long + " Day 1", "Ada", nullCell, nullCell, ""},
+		{long + " Day 2", "Grace", "not a number", "yesterday", "x"},
+		{"Boston/Cambridge", "Alan", "5", "2025-03-05 00:00:00", "y"},
+	}
+
+	bp := NewBaseProcessor(1)
+	fp := filepath.Join(t.TempDir(), "scans.xlsx")
+	if _, err := bp.WriteXLSXFile(1, teamData, fp); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var workbook xlsxTestWorkbook
+	readXLSXPart(t, zr, "xl/workbook.xml", &workbook)
+	wantNames := []string{"Boston Cambridge", "Greater Toronto Area Fall Unive", "Greater Toronto Area Fall U (2)"}
+	if len(workbook.Sheets) != len(wantNames) {
+		t.Fatalf("got %d sheets, want %d", len(workbook.Sheets), len(wantNames))
+	}
+	for i, want := range wantNames {
+		if got := workbook.Sheets[i].Name; got != want {
+			t.Errorf("sheet %d is named %q, want %q", i+1, got, want)
+		}
+	}
+
+	sheets := make([]xlsxTestWorksheet, len(wantNames))
+	for i := range sheets {
+		readXLSXPart(t, zr, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), &sheets[i])
+		pane := sheets[i].Pane
+		if pane.YSplit != "1" || pane.TopLeftCell != "A2" || pane.State != "frozen" {
+			t.Errorf("sheet %d pane = %+v, want the header row frozen", i+1, pane)
+		}
+		if header := sheets[i].Rows[0].Cells; len(header) != 5 || header[0].Inline != "Fair Name" {
+			t.Errorf("sheet %d header = %+v", i+1, header)
+		}
+	}
+
+	boston := sheets[0].Rows
+	if len(boston) != 3 {
+		t.Fatalf("the Boston sheet has %d rows, want a header and 2 data rows", len(boston))
+	}
+	first := boston[1].Cells
+	wantCells := []xlsxTestCell{
+		{Ref: "A2", Type: "inlineStr", Style: "1", Inline: "Boston/Cambridge"},
+		{Ref: "B2", Type: "inlineStr", Style: "1", Inline: "0042"},
+		{Ref: "C2", Value: "4"},
+		{Ref: "D2", Style: "2", Value: "45720.5"},
+		{Ref: "E2", Type: "inlineStr", Style: "1", Inline: `<b>&"Tom"` + "�\tend"},
+	}
+	if len(first) != len(wantCells) {
+		t.Fatalf("row 2 has %d cells, want %d", len(first), len(wantCells))
+	}
+	for i, want := range wantCells {
+		if first[i] != want {
+			t.Errorf("cell %s = %+v, want %+v", want.Ref, first[i], want)
+		}
+	}
+	if got := boston[2].Cells[3].Value; got != "45721" {
+		t.Errorf("midnight is serial %s, want 45721", got)
+	}
+
+	// NULL and empty cells are left out; values that don't parse fall back to text
+	if cells := sheets[1].Rows[1].Cells; len(cells) != 2 {
+		t.Errorf("row with NULL and empty cells wrote %+v", cells)
+	}
+	fallback := sheets[2].Rows[1].Cells
+	if fallback[2].Type != "inlineStr" || fallback[2].Inline != "not a number" {
+		t.Errorf("unparseable rating = %+v, want a text cell", fallback[2])
+	}
+	if fallback[3].Type != "inlineStr" || fallback[3].Inline != "yesterday" {
+		t.Errorf("unparseable scan time = %+v, want a text cell", fallback[3])
+	}
+}
+
+func TestUniqueSheetName(t *testing.T) {
+	used := make(map[string]bool)
+	for _, tc := range []struct{ name, want string }{
+		{"Fall: Day [1]", "Fall Day 1"},
+		{"", "Scans"},
+		{"scans", "scans (2)"},
+		{"'Quoted'", "Quoted"},
+		{strings.Repeat("フェア", 12), strings.Repeat("フェア", 10) + "フ"},
+	} {
+		if got := uniqueSheetName(tc.name, used); got != tc.want {
+			t.Errorf("uniqueSheetName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
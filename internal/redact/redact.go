@@ -0,0 +1,219 @@
+// Package redact keeps secrets out of logs. Secret values format as
+// [REDACTED] under every verb, and struct fields tagged sensitive:"true" are
+// replaced before a struct is printed.
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Placeholder replaces every redacted value.
+const Placeholder = "[REDACTED]"
+
+// Secret holds a decrypted secret. It never formats its contents and should
+// be wiped once it is no longer needed.
+type Secret []byte
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	return Placeholder
+}
+
+// GoString implements fmt.GoStringer, covering %#v.
+func (s Secret) GoString() string {
+	return Placeholder
+}
+
+// Format implements fmt.Formatter so no verb, including %x and %q, can print
+// the bytes.
+func (s Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, Placeholder)
+}
+
+// MarshalJSON keeps secrets out of JSON output.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Placeholder + `"`), nil
+}
+
+// UnmarshalJSON decodes a JSON string straight into the secret's bytes, so a
+// secret read from JSON never passes through a Go string, which can't be
+// wiped. The string's text in data is zeroed once decoded, since encoding/json
+// hands over the caller's input rather than a copy, and nothing but the secret
+// is left holding the value. null and "" leave the secret empty.
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errors.New("redact: a secret must be a JSON string")
+	}
+	raw := data[1 : len(data)-1]
+	defer Secret(raw).Wipe()
+
+	out, err := unquoteSecret(raw)
+	if err != nil {
+		Secret(out).Wipe()
+		return err
+	}
+	if len(out) == 0 {
+		out = nil
+	}
+	*s = out
+	return nil
+}
+
+// unquoteSecret decodes the escapes in a JSON string's text. Decoding never
+// lengthens the text, so the result is never reallocated and no partial copy
+// is left behind. On error the partial result is returned for wiping.
+func unquoteSecret(raw []byte) ([]byte, error) {
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			out = append(out, raw[i])
+			continue
+		}
+		if i+1 >= len(raw) {
+			return out, errors.New("redact: invalid escape in secret")
+		}
+		i++
+		switch raw[i] {
+		case '"', '\\', '/':
+			out = append(out, raw[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := hexRune(raw[i+1:])
+			if !ok {
+				return out, errors.New("redact: invalid escape in secret")
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				low, ok := rune(-1), false
+				if i+2 < len(raw) && raw[i+1] == '\\' && raw[i+2] == 'u' {
+					low, ok = hexRune(raw[i+3:])
+				}
+				if r = utf16.DecodeRune(r, low); ok && r != utf8.RuneError {
+					i += 6
+				}
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			return out, errors.New("redact: invalid escape in secret")
+		}
+	}
+	return out, nil
+}
+
+// hexRune parses the four hex digits of a \u escape.
+func hexRune(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+// Empty reports whether the secret holds no data.
+func (s Secret) Empty() bool {
+	return len(s) == 0
+}
+
+// Wipe overwrites the secret with zeros.
+func (s Secret) Wipe() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+// IsSensitive reports whether a struct field is tagged sensitive:"true".
+func IsSensitive(field reflect.StructField) bool {
+	return field.Tag.Get("sensitive") == "true"
+}
+
+// Args returns args with any struct, or pointer to struct, that has
+// sensitive fields replaced by a rendering of it with those fields redacted.
+// Other values are returned unchanged.
+func Args(args ...interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = Value(arg)
+	}
+	return redacted
+}
+
+// Value redacts a single value as described for Args.
+func Value(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || !hasSensitiveFields(rv.Type()) {
+		return v
+	}
+	return Struct(rv.Interface())
+}
+
+// Struct renders a struct like %+v with its sensitive fields redacted.
+func Struct(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "<nil>"
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Sprintf("%+v", v)
+	}
+
+	rt := rv.Type()
+	parts := make([]string, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := Placeholder
+		if !IsSensitive(field) {
+			value = fmt.Sprintf("%+v", Value(rv.Field(i).Interface()))
+		}
+		parts = append(parts, field.Name+":"+value)
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func hasSensitiveFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if IsSensitive(t.Field(i)) {
+			return true
+		}
+	}
+	return false
+}
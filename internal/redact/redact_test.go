@@ -0,0 +1,101 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSecretUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`"plain"`, "plain"},
+		{`"quote\" backslash\\ slash\/"`, `quote" backslash\ slash/`},
+		{`"tab\t newline\n cr\r \b\f"`, "tab\t newline\n cr\r \b\f"},
+		{`"café €"`, "café €"},
+		{`"pile of poo \ud83d\udca9"`, "pile of poo \U0001F4A9"},
+		{`"\u00e9\u20AC"`, "é€"},
+		{`"lone \ud83d surrogate"`, "lone � surrogate"},
+		{`"raw ünïcode"`, "raw ünïcode"},
+	}
+
+	for _, tc := range tests {
+		var got struct {
+			Value Secret `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(`{"value":`+tc.json+`}`), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tc.json, err)
+			continue
+		}
+		if string(got.Value) != tc.want {
+			t.Errorf("Unmarshal(%s) = %q, want %q", tc.json, []byte(got.Value), tc.want)
+		}
+
+		// The result must agree with encoding/json's own string decoding
+		var std string
+		if err := json.Unmarshal([]byte(tc.json), &std); err != nil {
+			t.Fatal(err)
+		}
+		if std != string(got.Value) {
+			t.Errorf("Unmarshal(%s) = %q, encoding/json gives %q", tc.json, []byte(got.Value), std)
+		}
+	}
+}
+
+func TestSecretUnmarshalJSONEmpty(t *testing.T) {
+	for _, input := range []string{`null`, `""`} {
+		s := Secret("previous")
+		if err := json.Unmarshal([]byte(input), &s); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", input, err)
+		}
+		if s != nil {
+			t.Errorf("Unmarshal(%s) left %d bytes, want nil", input, len(s))
+		}
+	}
+
+	var s Secret
+	if err := json.Unmarshal([]byte(`42`), &s); err == nil {
+		t.Error("a number was accepted as a secret")
+	}
+}
+
+func TestSecretNeverFormats(t *testing.T) {
+	s := Secret("hunter2")
+	for _, verb := range []string{"%v", "%s", "%q", "%x", "%#v", "%+v"} {
+		if got := fmt.Sprintf(verb, s); got != Placeholder {
+			t.Errorf("Sprintf(%s) = %q, want %q", verb, got, Placeholder)
+		}
+	}
+}
+
+func TestUnmarshalJSONWipesSource(t *testing.T) {
+	data := []byte(`{"password":"hunter2!","other":"kept"}`)
+	var v struct {
+		Password Secret `json:"password"`
+		Other    string `json:"other"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if string(v.Password) != "hunter2!" || v.Other != "kept" {
+		t.Fatalf("decoded %q and %q", v.Password, v.Other)
+	}
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Errorf("the source still holds the secret: %q", data)
+	}
+	if !bytes.Contains(data, []byte(`"other":"kept"`)) {
+		t.Errorf("text outside the secret was changed: %q", data)
+	}
+
+	var s Secret
+	bad := []byte(`"hunter2\x"`)
+	if err := s.UnmarshalJSON(bad); err == nil {
+		t.Fatal("expected an invalid escape error")
+	}
+	if bytes.Contains(bad, []byte("hunter2")) {
+		t.Errorf("the source still holds the secret after an error: %q", bad)
+	}
+}
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/strivescan/strivescan-sftp/internal/laravelcrypt"
+	"github.com/strivescan/strivescan-sftp/internal/logging"
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
+)
+
+// DBProvider decrypts the secrets stored Laravel-encrypted in the
+// sftp_credentials row itself.
+type DBProvider struct {
+	crypter *laravelcrypt.Encrypter
+}
+
+// NewDBProvider returns a provider decrypting with crypter.
+func NewDBProvider(crypter *laravelcrypt.Encrypter) *DBProvider {
+	return &DBProvider{crypter: crypter}
+}
+
+// DBProviderFromEnv builds a DBProvider from the Laravel keys in the
+// environment.
+func DBProviderFromEnv() (*DBProvider, error) {
+	crypter, err := laravelcrypt.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	return NewDBProvider(crypter), nil
+}
+
+// Name implements SecretProvider.
+func (p *DBProvider) Name() string {
+	return ProviderDB
+}
+
+// Secrets implements SecretProvider.
+func (p *DBProvider) Secrets(ctx context.Context, creds models.SFTPCredentials) (*Credentials, error) {
+	secrets := &Credentials{}
+	fields := []struct {
+		name      string
+		value     sql.NullString
+		decrypted *redact.Secret
+	}{
+		{"password", creds.Password, &secrets.Password},
+		{"SSH key", creds.SSHKey, &secrets.SSHKey},
+		{"passphrase", creds.Passphrase, &secrets.Passphrase},
+		{"zip password", creds.ZipPassword, &secrets.ZipPassword},
+		{"SOCKS5 username", creds.SOCKS5Username, &secrets.SOCKS5Username},
+		{"SOCKS5 password", creds.SOCKS5Password, &secrets.SOCKS5Password},
+	}
+	for _, field := range fields {
+		decrypted, err := p.decryptField(creds.TeamID, field.name, field.value)
+		if err != nil {
+			secrets.Wipe()
+			return nil, err
+		}
+		*field.decrypted = decrypted
+	}
+	return secrets, nil
+}
+
+// decryptField decrypts one Laravel-encrypted credential field. NULL and empty
+// values yield an empty secret.
+func (p *DBProvider) decryptField(teamID int64, name string, value sql.NullString) (redact.Secret, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+
+	logging.Printf("Attempting to decrypt %s for team %d\n", name, teamID)
+
+	decrypted, keyIndex, err := p.crypter.DecryptWithKeyIndex(value.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s for team %d: %w", name, teamID, err)
+	}
+	if keyIndex > 0 {
+		logging.Yellow("Decrypted %s for team %d with previous key #%d; key rotation is not complete", name, teamID, keyIndex)
+	}
+
+	return redact.Secret(decrypted), nil
+}
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/strivescan/strivescan-sftp/internal/laravelcrypt"
+	"github.com/strivescan/strivescan-sftp/internal/logging"
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// FileProvider reads secrets from a local file holding a single Laravel
+// payload, as written by the encrypt command, around a JSON object keyed by
+// team ID:
+//
+//	{"42": {"password": "...", "ssh_key": "...", "passphrase": "...", "zip_password": "...",
+//	        "socks5_username": "...", "socks5_password": "..."}}
+//
+// The file is decrypted on every lookup so no plaintext is kept between
+// teams.
+type FileProvider struct {
+	path    string
+	crypter *laravelcrypt.Encrypter
+}
+
+// NewFileProvider returns a provider for the encrypted file at path.
+func NewFileProvider(path string, crypter *laravelcrypt.Encrypter) *FileProvider {
+	return &FileProvider{path: path, crypter: crypter}
+}
+
+// FileProviderFromEnv builds a FileProvider for SECRETS_FILE. The file is
+// decrypted with SECRETS_FILE_KEY if set, otherwise with the Laravel keys.
+func FileProviderFromEnv() (*FileProvider, error) {
+	path := os.Getenv("SECRETS_FILE")
+	if path == "" {
+		return nil, errors.New("SECRETS_FILE environment variable not set")
+	}
+
+	var crypter *laravelcrypt.Encrypter
+	var err error
+	if key := os.Getenv("SECRETS_FILE_KEY"); key != "" {
+		crypter, err = laravelcrypt.New(key)
+	} else {
+		crypter, err = laravelcrypt.FromEnv()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secrets file key: %w", err)
+	}
+	return NewFileProvider(path, crypter), nil
+}
+
+// Name implements SecretProvider.
+func (p *FileProvider) Name() string {
+	return ProviderFile
+}
+
+// Secrets implements SecretProvider.
+func (p *FileProvider) Secrets(ctx context.Context, creds models.SFTPCredentials) (*Credentials, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	plaintext, keyIndex, err := p.crypter.DecryptWithKeyIndex(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file %s: %w", p.path, err)
+	}
+	defer wipeBytes(plaintext)
+	if keyIndex > 0 {
+		logging.Yellow("Decrypted secrets file %s for team %d with previous key #%d; key rotation is not complete", p.path, creds.TeamID, keyIndex)
+	}
+
+	// Every team's secrets are decoded; all but this team's are wiped
+	key := strconv.FormatInt(creds.TeamID, 10)
+	var teams map[string]entry
+	err = json.Unmarshal(plaintext, &teams)
+	for id, team := range teams {
+		if id != key || err != nil {
+			team.credentials().Wipe()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s is not a JSON object keyed by team ID: %w", p.path, err)
+	}
+
+	team, ok := teams[key]
+	if !ok {
+		return nil, fmt.Errorf("secrets file %s has no entry for team %d", p.path, creds.TeamID)
+	}
+	return team.credentials(), nil
+}
+
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,109 @@
+// Package secrets supplies the decrypted SFTP credentials for a team. The
+// default provider decrypts the Laravel-encrypted columns of sftp_credentials;
+// the others let teams keep their secrets in an encrypted file or in Vault, out
+// of the application database.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+	"github.com/strivescan/strivescan-sftp/internal/redact"
+)
+
+// Provider names accepted in SECRET_PROVIDER
+const (
+	ProviderDB    = "db"
+	ProviderFile  = "file"
+	ProviderVault = "vault"
+)
+
+// Credentials holds a team's decrypted secrets for the length of its
+// delivery. Wipe must be called once they are no longer needed. It zeroes
+// these fields only; the providers wipe their own decrypted buffers, but some
+// copies can't be wiped at all:
+//
+//   - password and keyboard-interactive auth answer with Go strings, as the
+//     SSH library requires, made when the server asks
+//   - a parsed SSH private key lives in its signer until the garbage
+//     collector frees it
+//   - VAULT_TOKEN, LARAVEL_ENCRYPTION_KEY and PGP_SIGNING_KEY_PASSPHRASE are
+//     read from the environment as strings, and the PGP signing key stays
+//     decrypted in memory
+//   - io.ReadAll in the encrypt command, and net/http reading a Vault
+//     response, leave the earlier buffers they outgrew to the garbage
+//     collector
+//
+// Anything new that holds a secret should use redact.Secret and be listed
+// here if it can't.
+type Credentials struct {
+	Password    redact.Secret
+	SSHKey      redact.Secret
+	Passphrase  redact.Secret
+	ZipPassword redact.Secret
+
+	// SOCKS5Username and SOCKS5Password authenticate to the team's SOCKS5
+	// proxy, if it requires it
+	SOCKS5Username redact.Secret
+	SOCKS5Password redact.Secret
+}
+
+// Wipe zeroes every decrypted value.
+func (c *Credentials) Wipe() {
+	c.Password.Wipe()
+	c.SSHKey.Wipe()
+	c.Passphrase.Wipe()
+	c.ZipPassword.Wipe()
+	c.SOCKS5Username.Wipe()
+	c.SOCKS5Password.Wipe()
+}
+
+// SecretProvider looks up the secrets for the team a sftp_credentials row
+// belongs to. Connection details such as host and username always come from
+// the row; only the secrets are provided.
+type SecretProvider interface {
+	// Name identifies the provider in log messages.
+	Name() string
+	// Secrets returns the team's secrets. The caller wipes them.
+	Secrets(ctx context.Context, creds models.SFTPCredentials) (*Credentials, error)
+}
+
+// entry is the JSON shape of a team's secrets in the file and Vault
+// providers. The values decode straight into bytes.
+type entry struct {
+	Password       redact.Secret `json:"password"`
+	SSHKey         redact.Secret `json:"ssh_key"`
+	Passphrase     redact.Secret `json:"passphrase"`
+	ZipPassword    redact.Secret `json:"zip_password"`
+	SOCKS5Username redact.Secret `json:"socks5_username"`
+	SOCKS5Password redact.Secret `json:"socks5_password"`
+}
+
+func (e entry) credentials() *Credentials {
+	return &Credentials{
+		Password:       e.Password,
+		SSHKey:         e.SSHKey,
+		Passphrase:     e.Passphrase,
+		ZipPassword:    e.ZipPassword,
+		SOCKS5Username: e.SOCKS5Username,
+		SOCKS5Password: e.SOCKS5Password,
+	}
+}
+
+// FromEnv returns the provider named by SECRET_PROVIDER, defaulting to the
+// database.
+func FromEnv() (SecretProvider, error) {
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("SECRET_PROVIDER"))); name {
+	case "", ProviderDB:
+		return DBProviderFromEnv()
+	case ProviderFile:
+		return FileProviderFromEnv()
+	case ProviderVault:
+		return VaultProviderFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown SECRET_PROVIDER %q, expected %q, %q or %q", name, ProviderDB, ProviderFile, ProviderVault)
+	}
+}
@@ -0,0 +1,162 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/strivescan/strivescan-sftp/internal/models"
+)
+
+// Vault defaults
+const (
+	defaultVaultMount = "secret"
+	defaultVaultPath  = "strivescan-sftp/teams/{team}"
+	vaultTimeout      = 10 * time.Second
+)
+
+// VaultProvider reads secrets from a HashiCorp Vault KV version 2 engine. Each
+// team has its own secret, found by replacing {team} in the path with the team
+// ID, holding password, ssh_key, passphrase, zip_password, socks5_username and
+// socks5_password keys.
+type VaultProvider struct {
+	Addr      string // e.g. https://vault.example.com:8200
+	Token     string
+	Namespace string // Vault Enterprise namespace, optional
+	Mount     string // KV mount, "secret" when empty
+	Path      string // Secret path within the mount; {team} is replaced
+
+	Client *http.Client
+}
+
+// VaultProviderFromEnv builds a VaultProvider from VAULT_ADDR, VAULT_TOKEN,
+// VAULT_NAMESPACE, VAULT_KV_MOUNT and VAULT_SECRET_PATH.
+func VaultProviderFromEnv() (*VaultProvider, error) {
+	p := &VaultProvider{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     os.Getenv("VAULT_KV_MOUNT"),
+		Path:      os.Getenv("VAULT_SECRET_PATH"),
+	}
+	if p.Addr == "" {
+		return nil, errors.New("VAULT_ADDR environment variable not set")
+	}
+	if p.Token == "" {
+		return nil, errors.New("VAULT_TOKEN environment variable not set")
+	}
+	return p, nil
+}
+
+// Name implements SecretProvider.
+func (p *VaultProvider) Name() string {
+	return ProviderVault
+}
+
+// secretURL returns the KV v2 read endpoint for a team.
+func (p *VaultProvider) secretURL(teamID int64) (string, error) {
+	base, err := url.Parse(strings.TrimRight(p.Addr, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid VAULT_ADDR: %w", err)
+	}
+
+	mount := p.Mount
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+	path := p.Path
+	if path == "" {
+		path = defaultVaultPath
+	}
+	path = strings.ReplaceAll(path, "{team}", strconv.FormatInt(teamID, 10))
+
+	return base.JoinPath("v1", strings.Trim(mount, "/"), "data", strings.Trim(path, "/")).String(), nil
+}
+
+// Secrets implements SecretProvider.
+func (p *VaultProvider) Secrets(ctx context.Context, creds models.SFTPCredentials) (*Credentials, error) {
+	endpoint, err := p.secretURL(creds.TeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: vaultTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret for team %d from Vault: %w", creds.TeamID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault response: %w", err)
+	}
+	defer wipeBytes(body)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("Vault returned %s for team %d: %s", resp.Status, creds.TeamID, vaultErrors(body))
+	}
+
+	// KV v2 wraps the secret's key/value pairs in data.data beside the
+	// version's metadata. A deleted or destroyed version comes back as a 404
+	// with null data and its metadata filled in.
+	var secret struct {
+		Data struct {
+			Data     *entry `json:"data"`
+			Metadata struct {
+				Version      int    `json:"version"`
+				DeletionTime string `json:"deletion_time"`
+				Destroyed    bool   `json:"destroyed"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(body, &secret)
+	if err != nil && secret.Data.Data != nil {
+		secret.Data.Data.credentials().Wipe()
+	}
+	metadata := secret.Data.Metadata
+	switch {
+	case metadata.Destroyed:
+		return nil, fmt.Errorf("Vault secret for team %d at %s has been destroyed (version %d)", creds.TeamID, endpoint, metadata.Version)
+	case metadata.DeletionTime != "":
+		return nil, fmt.Errorf("Vault secret for team %d at %s was deleted at %s (version %d)", creds.TeamID, endpoint, metadata.DeletionTime, metadata.Version)
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("Vault has no secret for team %d at %s", creds.TeamID, endpoint)
+	case err != nil:
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	case secret.Data.Data == nil:
+		return nil, fmt.Errorf("Vault secret for team %d has no data; it may have been deleted", creds.TeamID)
+	}
+	return secret.Data.Data.credentials(), nil
+}
+
+// vaultErrors extracts the messages from a Vault error response.
+func vaultErrors(body []byte) string {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Errors) == 0 {
+		return "no error details"
+	}
+	return strings.Join(resp.Errors, "; ")
+}